@@ -3,7 +3,12 @@ package clapp
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/afero"
@@ -14,6 +19,12 @@ var ErrConfigMustPointToAStruct error = errors.New("cannot point to non-struct v
 var ErrLogLevelMustBeInt error = errors.New("log level type in config struct must be int")
 var ErrLogFormatMustBeString error = errors.New("log format type in config struct must be string")
 
+type UnknownEnvVarsPolicy string
+
+const IgnoreUnknownEnvVars UnknownEnvVarsPolicy = ""
+const WarnOnUnknownEnvVars UnknownEnvVarsPolicy = "warn"
+const ErrorOnUnknownEnvVars UnknownEnvVarsPolicy = "error"
+
 type App struct {
 	Config          interface{}
 	ConfigPath      string
@@ -22,6 +33,87 @@ type App struct {
 	Fs              afero.Fs
 	Logger          zerolog.Logger
 	RootCommand     Command
+
+	// Args are the command line arguments to run with, os.Args[1:] is used
+	// when this is nil
+	Args []string
+
+	// DocsCommand adds a hidden gen-docs command to the root command
+	DocsCommand bool
+
+	// ValidateConfigSchema checks the config file against the schema derived
+	// from Config before it is decoded, see NewConfigSchema
+	ValidateConfigSchema bool
+
+	// StrictConfig rejects keys in the config file that don't map to a field
+	StrictConfig bool
+
+	// UnknownEnvVars decides what happens when a variable with the app's
+	// prefix doesn't map to a field in Config
+	UnknownEnvVars UnknownEnvVarsPolicy
+
+	// ResolveConfigReferences expands ${VAR} in the config file and resolves
+	// file: and env: references, along with those handled by ConfigResolvers
+	ResolveConfigReferences bool
+	ConfigResolvers         []Resolver
+
+	// Sources load the config in order, later sources override earlier ones.
+	// DefaultSources is used when this is nil.
+	Sources []Source
+
+	// Environ replaces the process environment for env overrides, the
+	// profile, reference resolution and NO_COLOR. The process environment is
+	// used when this is nil.
+	Environ Environ
+
+	// EnvPrefix is prepended to the env var of every config field, it
+	// defaults to the name of the root command made safe for use in a
+	// variable name e.g. my-tool becomes MY_TOOL
+	EnvPrefix string
+
+	// EnvNaming decides the env var for fields without an envconfig tag
+	EnvNaming EnvNaming
+
+	// Stdout and Stderr default to os.Stdout and os.Stderr. Executors write
+	// help and errors to them, handlers should use StdoutFromContext and
+	// StderrFromContext rather than writing to os.Stdout.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Middleware wraps the handler of every command, outside the middleware
+	// of the commands themselves
+	Middleware []Middleware
+
+	// Version is shown by the version command, when it is empty the version
+	// is set with ldflags or taken from the main module, see NewBuildInfo
+	Version string
+
+	// VersionCommand adds a version command and a --version flag to the root
+	// command
+	VersionCommand bool
+
+	// Help replaces the help of the executor with clapp's own, which can be
+	// customised with a template and shows the env var and config key of
+	// flags bound to the config
+	Help *HelpOptions
+
+	// OutputFlag adds a persistent --output/-o flag to the root command which
+	// chooses the format of the Printer from PrinterFromContext.
+	// DefaultOutput is used when the flag isn't given, it defaults to table.
+	OutputFlag    bool
+	DefaultOutput string
+
+	// Cleanup runs after the handler of the command that ran has returned or
+	// panicked, along with hooks registered with OnCleanup
+	Cleanup []CleanupFunc
+}
+
+func (a App) envPrefix() string {
+	if a.EnvPrefix != "" {
+		return a.EnvPrefix
+	}
+
+	return sanitiseEnvPrefix(a.RootCommand.Name)
 }
 
 func Run(a App, e Executor) error {
@@ -37,18 +129,221 @@ func Run(a App, e Executor) error {
 		initCtx = context.Background()
 	}
 
+	args := a.Args
+
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	root := a.RootCommand
+
+	if err := checkCommandGroups(root); err != nil {
+		return err
+	}
+
+	lookupEnv := lookupEnvFunc(a.Environ)
+	pre := flagPreParser(e)
+	profile := builtinProfile(&root, args, a.envPrefix(), lookupEnv, pre)
+	configPaths := builtinConfig(&root, args, a.envPrefix(), lookupEnv, pre)
+	showVersion := a.VersionCommand && builtinVersion(&root, args, pre)
+	showHelpAll := a.Help != nil && a.Help.HelpAll && builtinHelpAll(&root, args, pre)
+	output := &a.DefaultOutput
+
+	if a.OutputFlag {
+		var err error
+		output, err = builtinOutput(&root, args, a.DefaultOutput, pre)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	ctx := buildContext(initCtx, a.Fs, a.Logger, a.Config)
-	cfgManager, err := newConfigManager(ctx, a.Config, a.RootCommand.Name, a.ConfigPath, a.ConfigMustExist)
+	ctx = contextWithArgs(ctx, args)
+	ctx = contextWithEnviron(ctx, a.Environ)
+	ctx = contextWithOutput(ctx, a.Stdout, a.Stderr)
+	ctx = contextWithOutputFormat(ctx, output)
+	LogManagerFromContext(ctx).noColor = noColor(lookupEnv)
+	LogManagerFromContext(ctx).out = StderrFromContext(ctx)
+
+	// the version is shown before the config is loaded, so it works even when
+	// the config is broken
+	if showVersion {
+		return NewBuildInfo(a.RootCommand.Name, a.Version).Write(StdoutFromContext(ctx), TextVersion)
+	}
+
+	cfgOpts := []configOpt{
+		trackLiveOpt(newLiveConfig(configHolderFromContext(ctx), a.Config)),
+		EnvironOpt(a.Environ),
+		EnvPrefixOpt(a.envPrefix()),
+		EnvNamingOpt(a.EnvNaming),
+	}
+
+	if a.ValidateConfigSchema {
+		cfgOpts = append(cfgOpts, ValidateSchemaOpt())
+	}
+
+	if a.StrictConfig {
+		cfgOpts = append(cfgOpts, StrictOpt())
+	}
+
+	if a.ResolveConfigReferences {
+		cfgOpts = append(cfgOpts, ResolveReferencesOpt(a.ConfigResolvers...))
+	}
+
+	if profile != "" {
+		cfgOpts = append(cfgOpts, ProfileOpt(profile))
+	}
+
+	if len(configPaths) > 0 {
+		cfgOpts = append(cfgOpts, LayeredFilesOpt(configPaths...))
+	}
+
+	if cmds := commandsWithConfig(root); len(cmds) > 0 {
+		cfgOpts = append(cfgOpts, commandSectionsOpt(cmds))
+	}
+
+	if a.Sources != nil {
+		cfgOpts = append(cfgOpts, SourcesOpt(a.Sources...))
+	}
+
+	cfgManager := buildConfigManager(ctx, a.RootCommand.Name, a.ConfigPath, a.ConfigMustExist, cfgOpts...)
+
+	if err := cfgManager.runSources(ctx, a.Config); err != nil {
+		return err
+	}
+
+	// checked after the sources run so variables from a .env file are included
+	if err := checkUnknownEnvVars(ctx, cfgManager, a.Config, a.UnknownEnvVars); err != nil {
+		return err
+	}
+
+	ctx = contextWithConfigManager(ctx, cfgManager)
+
+	if a.VersionCommand && !hasChild(root, versionCommandName) {
+		root.Children = append(append([]Command{}, root.Children...), versionCommand(NewBuildInfo(a.RootCommand.Name, a.Version)))
+	}
+
+	if a.DocsCommand {
+		root.Children = append(append([]Command{}, root.Children...), docsCommand(a, root))
+	}
+
+	if a.Help != nil {
+		fields, err := collectEnvConfigFields(a.Config, a.envPrefix(), a.EnvNaming)
+
+		if err != nil {
+			return err
+		}
+
+		defaults, _ := collectConfigFields(cfgManager.builtinDefaults(), "")
+		h, err := newHelpRenderer(*a.Help, root, fields, defaults, lookupEnv, StdoutFromContext(ctx))
+
+		if err != nil {
+			return err
+		}
+
+		if showHelpAll {
+			return h.renderAll(StdoutFromContext(ctx), helpAllPath(root, args))
+		}
+
+		ctx = contextWithHelpRenderer(ctx, h)
+	}
+
+	// the command config is loaded first so middleware can use it
+	root = withMiddleware(root, a.Middleware)
+	root = withCommandConfigs(root)
+	ctx = contextWithCommandConfig(ctx)
+	root = withPanicRecovery(root)
+	ctx = contextWithCleanup(ctx, a.Cleanup)
+
+	return e.Run(root, ctx, a.Config)
+}
+
+// builtinEnvVars are read by clapp itself, prefixed with the app's env prefix.
+var builtinEnvVars = []string{"PROFILE", "CONFIG"}
+
+// builtinProfile adds the --profile flag to the root command and returns the
+// profile selected by it, or by the <PREFIX>_PROFILE env var.
+func builtinProfile(root *Command, args []string, envPrefix string, lookupEnv func(string) (string, bool), pre FlagPreParser) string {
+	var profile string
+
+	f, added := addBuiltinFlag(root, Flag{
+		Name:        "profile",
+		Description: fmt.Sprintf("Overlay <name>.<profile>.yaml on the config file (env: %s_PROFILE)", strings.ToUpper(envPrefix)),
+		ValueRef:    &profile,
+		Type:        StringFlag,
+	})
+
+	if added {
+		if vals := pre.PreParseFlag(args, f); len(vals) > 0 {
+			return vals[len(vals)-1]
+		}
+	}
+
+	profile, _ = lookupEnv(fmt.Sprintf("%s_PROFILE", strings.ToUpper(envPrefix)))
+
+	return profile
+}
+
+// builtinConfig adds the --config flag to the root command and returns the
+// config files given by it, or by the <PREFIX>_CONFIG env var as a list
+// separated like PATH. The flag can be repeated to layer several files.
+func builtinConfig(root *Command, args []string, envPrefix string, lookupEnv func(string) (string, bool), pre FlagPreParser) []string {
+	var paths []string
+	envVar := fmt.Sprintf("%s_CONFIG", strings.ToUpper(envPrefix))
+
+	f, added := addBuiltinFlag(root, Flag{
+		Name:        "config",
+		Short:       "c",
+		Description: fmt.Sprintf("Config file to load, repeat to layer files (env: %s)", envVar),
+		ValueRef:    &paths,
+		Type:        StringSliceFlag,
+	})
+
+	if added {
+		given := []string{}
+		for _, v := range pre.PreParseFlag(args, f) {
+			// split as the string slice flag does
+			given = append(given, strings.Split(v, ",")...)
+		}
+
+		if len(given) > 0 {
+			return given
+		}
+	}
+
+	if v, ok := lookupEnv(envVar); ok && v != "" {
+		return filepath.SplitList(v)
+	}
+
+	return nil
+}
+
+func checkUnknownEnvVars(ctx context.Context, c *Config, cfg interface{}, policy UnknownEnvVarsPolicy) error {
+	if policy == IgnoreUnknownEnvVars {
+		return nil
+	}
+
+	unknown, err := c.UnknownEnvVars(cfg)
 
 	if err != nil {
 		return err
 	}
 
-	if err := cfgManager.OverrideWithEnvVars(a.Config); err != nil {
-		return ErrOverridingConfigWithEnvFailed{
-			wrapped: err,
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	if policy == ErrorOnUnknownEnvVars {
+		return ErrUnknownEnvVars{
+			Names: unknown,
 		}
 	}
 
-	return e.Run(a.RootCommand, ctx, a.Config)
+	l := LoggerFromContext(ctx)
+	for _, name := range unknown {
+		l.Warn().Str("var", name).Msg("environment variable does not map to any config field")
+	}
+
+	return nil
 }
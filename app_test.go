@@ -1,10 +1,14 @@
 package clapp
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"os"
 	"testing"
 
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,9 +16,14 @@ var ErrHandleError error = errors.New("some fake error")
 
 type DummyExecutor struct {
 	err error
+	cmd Command
+	ctx context.Context
 }
 
 func (e *DummyExecutor) Run(c Command, ctx context.Context, cfg interface{}) error {
+	e.cmd = c
+	e.ctx = ctx
+
 	return e.err
 }
 
@@ -45,8 +54,8 @@ func TestRun(t *testing.T) {
 					Name: "testing",
 				},
 			},
-			exec:        &DummyExecutor{},
-			expectedErr: ErrConfigNotFound,
+			exec:            &DummyExecutor{},
+			expectedErrType: ErrConfigFileNotFound{},
 		},
 		{
 			name: "errors if the config could not be loaded (invalid yaml)",
@@ -127,3 +136,266 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRun_AddsDocsCommand(t *testing.T) {
+	exec := &DummyExecutor{}
+	children := []Command{
+		{
+			Name: "child",
+		},
+	}
+
+	err := Run(App{
+		Config:      &testConf{},
+		Fs:          buildMockFs(),
+		DocsCommand: true,
+		RootCommand: Command{
+			Name:     "testing",
+			Children: children,
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+	assert.Len(t, exec.cmd.Children, 2)
+	assert.Equal(t, docsCommandName, exec.cmd.Children[1].Name)
+	// The app's own command tree is left untouched
+	assert.Len(t, children, 1)
+}
+
+func TestRun_UnknownEnvVars(t *testing.T) {
+	os.Setenv("UNKNOWNAPP_SHOULD_ENABLE_THAT", "typo")
+	defer os.Unsetenv("UNKNOWNAPP_SHOULD_ENABLE_THAT")
+
+	tests := []struct {
+		name        string
+		policy      UnknownEnvVarsPolicy
+		expectedErr error
+		expectedLog string
+	}{
+		{
+			name:   "unknown vars are ignored by default",
+			policy: IgnoreUnknownEnvVars,
+		},
+		{
+			name:        "unknown vars are logged as warnings",
+			policy:      WarnOnUnknownEnvVars,
+			expectedLog: `"var":"UNKNOWNAPP_SHOULD_ENABLE_THAT"`,
+		},
+		{
+			name:   "unknown vars cause an error",
+			policy: ErrorOnUnknownEnvVars,
+			expectedErr: ErrUnknownEnvVars{
+				Names: []string{"UNKNOWNAPP_SHOULD_ENABLE_THAT"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			b := new(bytes.Buffer)
+
+			err := Run(App{
+				Config:         &testConf{},
+				Fs:             buildMockFs(),
+				Logger:         zerolog.New(b),
+				UnknownEnvVars: test.policy,
+				RootCommand: Command{
+					Name: "unknownapp",
+				},
+			}, &DummyExecutor{})
+
+			assert.Equal(tt, test.expectedErr, err)
+
+			if test.expectedLog == "" {
+				assert.Empty(tt, b.String())
+				return
+			}
+
+			assert.Contains(tt, b.String(), test.expectedLog)
+		})
+	}
+}
+
+func TestRun_Profile(t *testing.T) {
+	fs := buildMockFs()
+	assert.Nil(t, afero.WriteFile(fs, "/profiles/profiled.yaml", []byte("should-do-that: base"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/profiles/profiled.dev.yaml", []byte("should-do-that: dev"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/profiles/profiled.prod.yaml", []byte("should-do-that: prod"), 0644))
+
+	tests := []struct {
+		name     string
+		args     []string
+		env      string
+		expected string
+	}{
+		{
+			name:     "no profile",
+			args:     []string{},
+			expected: "base",
+		},
+		{
+			name:     "profile from flag",
+			args:     []string{"--profile", "dev"},
+			expected: "dev",
+		},
+		{
+			name:     "profile from env",
+			args:     []string{},
+			env:      "prod",
+			expected: "prod",
+		},
+		{
+			name:     "flag takes precedence over env",
+			args:     []string{"--profile=dev"},
+			env:      "prod",
+			expected: "dev",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			if test.env != "" {
+				os.Setenv("PROFILED_PROFILE", test.env)
+				defer os.Unsetenv("PROFILED_PROFILE")
+			}
+
+			cfg := &testConf{}
+			exec := &DummyExecutor{}
+
+			err := Run(App{
+				Config:     cfg,
+				ConfigPath: "/profiles/profiled.yaml",
+				Fs:         fs,
+				Args:       test.args,
+				RootCommand: Command{
+					Name: "profiled",
+				},
+			}, exec)
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, cfg.ShouldDoThat)
+			assert.Equal(tt, test.args, ArgsFromContext(exec.ctx))
+			assert.Equal(tt, "profile", exec.cmd.PersistentFlags[0].Name)
+		})
+	}
+}
+
+func TestRun_ConfigFlag(t *testing.T) {
+	fs := buildMockFs()
+	assert.Nil(t, afero.WriteFile(fs, "/layers/default.yaml", []byte("should-do-that: default"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/layers/base.yaml", []byte("should-do-that: base\nshould-enable-this: base"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/layers/override.yaml", []byte("should-do-that: override"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/layers/base.dev.yaml", []byte("should-enable-this: dev"), 0644))
+
+	tests := []struct {
+		name            string
+		args            []string
+		env             Environ
+		rootFlags       []Flag
+		expected        testConf
+		expectedErrType error
+	}{
+		{
+			name: "app config path is used without the flag",
+			args: []string{},
+			expected: testConf{
+				ShouldDoThat: "default",
+			},
+		},
+		{
+			name: "flag replaces the app config path",
+			args: []string{"--config", "/layers/base.yaml"},
+			expected: testConf{
+				ShouldDoThat:     "base",
+				ShouldEnableThis: "base",
+			},
+		},
+		{
+			name: "repeated flag layers files",
+			args: []string{"-c", "/layers/base.yaml", "--config=/layers/override.yaml"},
+			expected: testConf{
+				ShouldDoThat:     "override",
+				ShouldEnableThis: "base",
+			},
+		},
+		{
+			name: "profile overlays the first file",
+			args: []string{"-c/layers/base.yaml", "-c", "/layers/override.yaml", "--profile", "dev"},
+			expected: testConf{
+				ShouldDoThat:     "override",
+				ShouldEnableThis: "dev",
+			},
+		},
+		{
+			name: "env var lists files",
+			args: []string{},
+			env: Environ{
+				"LAYERED_CONFIG": "/layers/base.yaml:/layers/override.yaml",
+			},
+			expected: testConf{
+				ShouldDoThat:     "override",
+				ShouldEnableThis: "base",
+			},
+		},
+		{
+			name: "flag takes precedence over env",
+			args: []string{"-c", "/layers/base.yaml"},
+			env: Environ{
+				"LAYERED_CONFIG": "/layers/override.yaml",
+			},
+			expected: testConf{
+				ShouldDoThat:     "base",
+				ShouldEnableThis: "base",
+			},
+		},
+		{
+			name:            "given files must exist",
+			args:            []string{"--config", "/layers/missing.yaml"},
+			expectedErrType: ErrConfigFileNotFound{},
+		},
+		{
+			name: "not added when the app defines the flag",
+			args: []string{"--config", "/layers/base.yaml"},
+			rootFlags: []Flag{
+				{
+					Name:     "config",
+					ValueRef: new(string),
+					Type:     StringFlag,
+				},
+			},
+			expected: testConf{
+				ShouldDoThat: "default",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			env := test.env
+			if env == nil {
+				env = Environ{}
+			}
+
+			cfg := &testConf{}
+			err := Run(App{
+				Config:     cfg,
+				ConfigPath: "/layers/default.yaml",
+				Fs:         fs,
+				Args:       test.args,
+				Environ:    env,
+				RootCommand: Command{
+					Name:       "layered",
+					LocalFlags: test.rootFlags,
+				},
+			}, &DummyExecutor{})
+
+			if test.expectedErrType != nil {
+				assert.IsType(tt, test.expectedErrType, err)
+				return
+			}
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, *cfg)
+		})
+	}
+}
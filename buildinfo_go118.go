@@ -0,0 +1,23 @@
+//go:build go1.18
+// +build go1.18
+
+package clapp
+
+import "runtime/debug"
+
+// vcsSettings returns the version control details the go tool embeds in
+// binaries from go 1.18.
+func vcsSettings(info *debug.BuildInfo) (revision string, time string, dirty bool) {
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			time = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+
+	return
+}
@@ -0,0 +1,12 @@
+//go:build !go1.18
+// +build !go1.18
+
+package clapp
+
+import "runtime/debug"
+
+// vcsSettings returns nothing as version control details are only embedded
+// from go 1.18, use ldflags instead.
+func vcsSettings(info *debug.BuildInfo) (revision string, time string, dirty bool) {
+	return
+}
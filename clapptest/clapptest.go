@@ -0,0 +1,172 @@
+// Package clapptest runs clapp apps in process for end-to-end tests, with an
+// in-memory filesystem, an isolated environment and captured output.
+//
+//	res := clapptest.Run(app, clapptest.Options{
+//		Env:   map[string]string{"MY_APP_PORT": "8080"},
+//		Files: map[string]string{"/etc/my-app.yaml": "host: example.com"},
+//	}, "serve", "--verbose")
+//
+//	assert.Equal(t, 0, res.ExitCode)
+//	assert.Contains(t, res.Stdout, "listening on example.com:8080")
+package clapptest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
+	"github.com/svartlfheim/clapp"
+)
+
+type Options struct {
+	// Env replaces the process environment, which is never read
+	Env map[string]string
+
+	// Files are written to the app's filesystem before it runs, keyed by
+	// path. An in-memory filesystem is used when App.Fs is nil.
+	Files map[string]string
+
+	// Executor defaults to clapp.NewCobraExecutor
+	Executor clapp.Executor
+
+	// LogLevel is the lowest level captured in Result.Logs, it defaults to
+	// debug
+	LogLevel zerolog.Level
+}
+
+// LogEntry is a decoded log line.
+type LogEntry map[string]interface{}
+
+func (e LogEntry) Level() string {
+	l, _ := e[zerolog.LevelFieldName].(string)
+
+	return l
+}
+
+func (e LogEntry) Message() string {
+	m, _ := e[zerolog.MessageFieldName].(string)
+
+	return m
+}
+
+type Result struct {
+	Err      error
+	ExitCode int
+	Stdout   string
+	Stderr   string
+
+	// Logs are the entries written to App.Logger. Apps that change the log
+	// format, with UpdateLoggerConfigPreRun, write their logs to Stderr
+	// instead.
+	Logs []LogEntry
+
+	// Config is the config the app finished with, which is App.Config unless
+	// it was reloaded
+	Config interface{}
+
+	// Fs is the filesystem the app ran with
+	Fs afero.Fs
+}
+
+// Messages returns the message of every log entry, in order.
+func (r Result) Messages() []string {
+	msgs := []string{}
+
+	for _, e := range r.Logs {
+		msgs = append(msgs, e.Message())
+	}
+
+	return msgs
+}
+
+// recordingExecutor keeps the context the app ran with, so the final config
+// can be read from it.
+type recordingExecutor struct {
+	clapp.Executor
+	ctx context.Context
+}
+
+func (e *recordingExecutor) Run(c clapp.Command, ctx context.Context, cfg interface{}) error {
+	e.ctx = ctx
+
+	return e.Executor.Run(c, ctx, cfg)
+}
+
+// Run runs the app with args. The app's Args, Environ, Logger, Stdout and
+// Stderr are replaced, everything else is used as it is.
+func Run(app clapp.App, o Options, args ...string) Result {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	logs := &bytes.Buffer{}
+
+	if app.Fs == nil {
+		app.Fs = afero.NewMemMapFs()
+	}
+
+	res := Result{
+		Config: app.Config,
+		Fs:     app.Fs,
+	}
+
+	for path, content := range o.Files {
+		if err := afero.WriteFile(app.Fs, path, []byte(content), 0644); err != nil {
+			res.Err = err
+			res.ExitCode = clapp.ExitCode(err)
+
+			return res
+		}
+	}
+
+	env := clapp.Environ{}
+	for k, v := range o.Env {
+		env[k] = v
+	}
+
+	app.Args = append([]string{}, args...)
+	app.Environ = env
+	app.Logger = zerolog.New(logs).Level(o.LogLevel)
+	app.Stdout = stdout
+	app.Stderr = stderr
+
+	e := o.Executor
+	if e == nil {
+		e = clapp.NewCobraExecutor()
+	}
+
+	rec := &recordingExecutor{
+		Executor: e,
+	}
+
+	res.Err = clapp.Run(app, rec)
+	res.ExitCode = clapp.ExitCode(res.Err)
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+	res.Logs = decodeLogs(logs.Bytes())
+
+	if rec.ctx != nil {
+		res.Config = clapp.ConfigFromContext(rec.ctx)
+	}
+
+	return res
+}
+
+func decodeLogs(b []byte) []LogEntry {
+	entries := []LogEntry{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+
+	for s.Scan() {
+		e := LogEntry{}
+
+		// untestable: zerolog always writes a json object per line
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries
+}
@@ -0,0 +1,138 @@
+package clapptest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/svartlfheim/clapp"
+	"github.com/svartlfheim/clapp/stdflag"
+)
+
+type testConf struct {
+	Host string `yaml:"host" envconfig:"HOST"`
+	Port int    `yaml:"port" envconfig:"PORT"`
+}
+
+type exitError struct{}
+
+func (e exitError) Error() string {
+	return "bad input"
+}
+
+func (e exitError) ExitCode() int {
+	return 2
+}
+
+func buildTestApp() clapp.App {
+	cfg := &testConf{
+		Host: "localhost",
+		Port: 80,
+	}
+
+	return clapp.App{
+		Config:     cfg,
+		ConfigPath: "/test-app.yaml",
+		RootCommand: clapp.Command{
+			Name: "test-app",
+			Descriptions: clapp.Descriptions{
+				Short: "An app for testing clapptest",
+			},
+			LocalFlags: []clapp.Flag{
+				{
+					Name:        "port",
+					Short:       "p",
+					Description: "Port to listen on",
+					ValueRef:    &cfg.Port,
+					Type:        clapp.IntFlag,
+				},
+			},
+			Handle: func(cmd *cobra.Command, args []string) error {
+				ctx := cmd.Context()
+				c := clapp.ConfigFromContext(ctx).(*testConf)
+
+				l := clapp.LoggerFromContext(ctx)
+				l.Info().Int("port", c.Port).Msg("starting")
+				fmt.Fprintf(clapp.StdoutFromContext(ctx), "listening on %s:%d\n", c.Host, c.Port)
+				fmt.Fprintln(clapp.StderrFromContext(ctx), "warning")
+
+				if len(args) > 0 && args[0] == "fail" {
+					return exitError{}
+				}
+
+				return afero.WriteFile(clapp.FsFromContext(ctx), "/out.txt", []byte("done"), 0644)
+			},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	res := Run(buildTestApp(), Options{
+		Env: map[string]string{
+			"TEST_APP_HOST": "example.com",
+		},
+		Files: map[string]string{
+			"/test-app.yaml": "port: 8080\n",
+		},
+	})
+
+	assert.Nil(t, res.Err)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, "listening on example.com:8080\n", res.Stdout)
+	assert.Equal(t, "warning\n", res.Stderr)
+	assert.Equal(t, &testConf{Host: "example.com", Port: 8080}, res.Config)
+	assert.Equal(t, []string{"starting"}, res.Messages())
+	assert.Equal(t, "info", res.Logs[0].Level())
+	assert.Equal(t, float64(8080), res.Logs[0]["port"])
+
+	out, err := afero.ReadFile(res.Fs, "/out.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "done", string(out))
+}
+
+func TestRun_Args(t *testing.T) {
+	res := Run(buildTestApp(), Options{}, "--port", "9000")
+
+	assert.Nil(t, res.Err)
+	assert.Equal(t, "listening on localhost:9000\n", res.Stdout)
+}
+
+func TestRun_ExitCode(t *testing.T) {
+	res := Run(buildTestApp(), Options{}, "fail")
+
+	assert.Equal(t, exitError{}, res.Err)
+	assert.Equal(t, 2, res.ExitCode)
+}
+
+func TestRun_ErrorsAreWrittenToStderr(t *testing.T) {
+	res := Run(buildTestApp(), Options{}, "--nope")
+
+	assert.Error(t, res.Err)
+	assert.Equal(t, 1, res.ExitCode)
+	assert.Contains(t, res.Stderr, "unknown flag --nope")
+}
+
+func TestRun_LogLevel(t *testing.T) {
+	res := Run(buildTestApp(), Options{
+		LogLevel: zerolog.WarnLevel,
+	})
+
+	assert.Nil(t, res.Err)
+	assert.Empty(t, res.Logs)
+}
+
+func TestRun_Executor(t *testing.T) {
+	res := Run(buildTestApp(), Options{
+		Executor: stdflag.NewExecutor(),
+	}, "-p", "9000")
+
+	assert.Nil(t, res.Err)
+	assert.Equal(t, "listening on localhost:9000\n", res.Stdout)
+}
+
+func TestAssertHelpGolden(t *testing.T) {
+	AssertHelpGolden(t, "testdata/help.golden", buildTestApp(), Options{})
+}
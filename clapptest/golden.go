@@ -0,0 +1,56 @@
+package clapptest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svartlfheim/clapp"
+)
+
+// UpdateGoldenEnvVar makes AssertGolden write the golden file rather than
+// compare against it when it is set to a non-empty value e.g.
+// CLAPPTEST_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnvVar string = "CLAPPTEST_UPDATE_GOLDEN"
+
+// AssertGolden compares got with the contents of the golden file at path,
+// which is usually under testdata.
+func AssertGolden(t testing.TB, path string, got string) bool {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnvVar) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("could not create directory for golden file: %s", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+
+		return true
+	}
+
+	want, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatalf("could not read golden file, set %s=1 to create it: %s", UpdateGoldenEnvVar, err)
+	}
+
+	return assert.Equal(t, string(want), got, "output differs from %s, set %s=1 to update it", path, UpdateGoldenEnvVar)
+}
+
+// AssertHelpGolden runs the app with args followed by --help and compares the
+// help it writes with the golden file at path.
+func AssertHelpGolden(t testing.TB, path string, app clapp.App, o Options, args ...string) bool {
+	t.Helper()
+
+	res := Run(app, o, append(append([]string{}, args...), "--help")...)
+
+	if res.Err != nil {
+		t.Fatalf("running with --help failed: %s", res.Err)
+	}
+
+	return AssertGolden(t, path, res.Stdout)
+}
@@ -2,23 +2,38 @@ package clapp
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
-type cobraBuilder struct {
-	_cmd *cobra.Command
+// boundFlag links the storage a flag is parsed into with its ValueRef.
+// applied is set once the parsed value has been copied to the ValueRef.
+type boundFlag struct {
+	ref     interface{}
+	parsed  interface{}
+	applied bool
 }
 
-type CobraExecutor struct {
-	_builder *cobraBuilder
+type cobraBuilder struct {
+	_cmd    *cobra.Command
+	_fields []configField
+
+	// _defaults are the config fields before any source was loaded
+	_defaults []configField
+
+	// _bound is shared by every builder in the tree, as persistent flags are
+	// parsed by the command that runs rather than the one defining them
+	_bound map[*pflag.Flag]*boundFlag
 }
 
+type CobraExecutor struct{}
+
 func NewCobraExecutor() *CobraExecutor {
-	return &CobraExecutor{
-		_builder: newCobraBuilder().(*cobraBuilder),
-	}
+	return &CobraExecutor{}
 }
 
 func newCobraBuilder() builder {
@@ -28,7 +43,21 @@ func newCobraBuilder() builder {
 }
 
 func (e CobraExecutor) Run(c Command, ctx context.Context, cfg interface{}) error {
-	cmd, err := e._builder.Build(c, cfg)
+	// the tree is built for each run, as flags record whether they were given
+	b := newCobraBuilder().(*cobraBuilder)
+	b._defaults, _ = collectConfigFields(ConfigManagerFromContext(ctx).builtinDefaults(), "")
+
+	// set before building so CustomConfiguration can replace them
+	b._cmd.SetOut(StdoutFromContext(ctx))
+	b._cmd.SetErr(StderrFromContext(ctx))
+
+	b._cmd.SetFlagErrorFunc(cobraFlagError)
+
+	if h := helpRendererFromContext(ctx); h != nil {
+		setCobraHelpRenderer(b._cmd, h)
+	}
+
+	cmd, err := b.Build(c, cfg)
 
 	if err != nil {
 		return err
@@ -36,7 +65,44 @@ func (e CobraExecutor) Run(c Command, ctx context.Context, cfg interface{}) erro
 
 	cobraCmd := cmd.(*cobra.Command)
 
-	return cobraCmd.ExecuteContext(ctx)
+	if args := ArgsFromContext(ctx); args != nil {
+		cobraCmd.SetArgs(args)
+	}
+
+	// cobra's own error for an unknown command is worded differently to
+	// ErrUnknownCommand, so errors are printed here instead, unless
+	// CustomConfiguration silenced them
+	silenced := cobraCmd.SilenceErrors
+	cobraCmd.SilenceErrors = true
+	cobraCmd.DisableSuggestions = true
+
+	err = cobraUnknownCommand(c, cobraCmd.ExecuteContext(ctx))
+
+	if err != nil && !silenced {
+		printCommandError(cobraCmd.ErrOrStderr(), err)
+	}
+
+	return err
+}
+
+// setCobraHelpRenderer has c and its children use h for help, cobra's help is
+// kept for commands that aren't in the tree e.g. its help command.
+func setCobraHelpRenderer(c *cobra.Command, h *helpRenderer) {
+	cobraHelp := c.HelpFunc()
+
+	c.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		path := strings.Fields(cmd.CommandPath())[1:]
+		found, err := h.render(cmd.OutOrStdout(), path)
+
+		if err != nil {
+			cmd.PrintErrln("Error:", err.Error())
+			return
+		}
+
+		if !found {
+			cobraHelp(cmd, args)
+		}
+	})
 }
 
 func (b *cobraBuilder) setName(n string) {
@@ -162,9 +228,87 @@ func (b *cobraBuilder) handleFlag(s *pflag.FlagSet, f Flag) error {
 	}
 }
 
+// addFlag registers the flag with its own storage, starting with the current
+// value of the ValueRef. The ValueRef is only updated, by applyFlags, when the
+// flag is given.
+func (b *cobraBuilder) addFlag(s *pflag.FlagSet, f Flag) error {
+	parsed := f
+
+	if rv := reflect.ValueOf(f.ValueRef); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		storage := reflect.New(rv.Type().Elem())
+		storage.Elem().Set(rv.Elem())
+		parsed.ValueRef = storage.Interface()
+	}
+
+	if err := b.handleFlag(s, parsed); err != nil {
+		return err
+	}
+
+	if b._bound == nil {
+		b._bound = map[*pflag.Flag]*boundFlag{}
+	}
+
+	b._bound[s.Lookup(f.Name)] = &boundFlag{
+		ref:    f.ValueRef,
+		parsed: parsed.ValueRef,
+	}
+
+	b.describeDefault(s, f)
+	b.markSecretFlag(s, f)
+
+	return nil
+}
+
+// describeDefault adds the built in default to the help of a flag bound to a
+// config field, when the config file or env has changed it. The default shown
+// by the flag is then the value from the file or env.
+func (b *cobraBuilder) describeDefault(s *pflag.FlagSet, f Flag) {
+	ref, changed := builtinDefault(f, b._fields, b._defaults)
+
+	if !changed {
+		return
+	}
+
+	builtin := f
+	builtin.ValueRef = ref
+
+	tmp := pflag.NewFlagSet("", pflag.ContinueOnError)
+
+	// untestable: the same flag was already added successfully
+	if err := b.handleFlag(tmp, builtin); err != nil {
+		return
+	}
+
+	pf := s.Lookup(f.Name)
+	def := tmp.Lookup(f.Name).DefValue
+
+	// quoted as pflag does for the default it shows
+	if pf.Value.Type() == "string" {
+		def = fmt.Sprintf("%q", def)
+	}
+
+	pf.Usage = fmt.Sprintf("%s (built-in default %s)", pf.Usage, def)
+}
+
+// markSecretFlag hides the default value of secret flags from help output and
+// annotates them so their values are masked when logged.
+func (b *cobraBuilder) markSecretFlag(s *pflag.FlagSet, f Flag) {
+	cf, bound := configFieldForRef(b._fields, f.ValueRef)
+
+	if !f.Secret && !(bound && cf.Secret()) {
+		return
+	}
+
+	pf := s.Lookup(f.Name)
+	pf.DefValue = maskSecret(pf.DefValue)
+
+	// untestable: the flag was added to the set by the caller
+	_ = s.SetAnnotation(f.Name, secretFlagAnnotation, []string{"true"})
+}
+
 func (b *cobraBuilder) addPersistentFlags(flags ...Flag) error {
 	for _, f := range flags {
-		if err := b.handleFlag(b._cmd.PersistentFlags(), f); err != nil {
+		if err := b.addFlag(b._cmd.PersistentFlags(), f); err != nil {
 			return err
 		}
 
@@ -187,7 +331,7 @@ func (b *cobraBuilder) addPersistentFlags(flags ...Flag) error {
 
 func (b *cobraBuilder) addLocalFlags(flags ...Flag) error {
 	for _, f := range flags {
-		if err := b.handleFlag(b._cmd.Flags(), f); err != nil {
+		if err := b.addFlag(b._cmd.Flags(), f); err != nil {
 			return err
 		}
 
@@ -203,8 +347,82 @@ func (b *cobraBuilder) addLocalFlags(flags ...Flag) error {
 	return nil
 }
 
+// logFlags writes the flags that were set to the debug log, masking secrets.
+func logFlags(c *cobra.Command) {
+	ctx := c.Context()
+
+	if ctx == nil {
+		return
+	}
+
+	lm, ok := ctx.Value(LogManagerContextKey).(*LogManager)
+
+	if !ok {
+		return
+	}
+
+	c.Flags().Visit(func(f *pflag.Flag) {
+		v := f.Value.String()
+
+		if _, secret := f.Annotations[secretFlagAnnotation]; secret {
+			v = maskSecret(v)
+		}
+
+		lm.logger.Debug().Str("command", c.CommandPath()).Str("flag", f.Name).Str("value", v).Msg("flag set")
+	})
+}
+
+// applyFlags copies the value of every flag that was given to its ValueRef.
+// Each is only copied once, so a hook that changes the ValueRef isn't undone
+// before the handler runs.
+func (b *cobraBuilder) applyFlags(c *cobra.Command) {
+	c.Flags().Visit(func(f *pflag.Flag) {
+		if bf, ok := b._bound[f]; ok && !bf.applied {
+			bf.applied = true
+			applyFlag(c.Context(), bf.ref, bf.parsed)
+		}
+	})
+}
+
+// applyFlagsBeforeHooks wraps any pre run hooks of the command, such as those
+// added by CustomConfiguration, so they see the values of the flags given.
+func (b *cobraBuilder) applyFlagsBeforeHooks() {
+	c := b._cmd
+
+	if h := c.PersistentPreRunE; h != nil {
+		c.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+			b.applyFlags(cmd)
+			return h(cmd, args)
+		}
+	}
+
+	if h := c.PersistentPreRun; h != nil {
+		c.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+			b.applyFlags(cmd)
+			h(cmd, args)
+		}
+	}
+
+	if h := c.PreRunE; h != nil {
+		c.PreRunE = func(cmd *cobra.Command, args []string) error {
+			b.applyFlags(cmd)
+			return h(cmd, args)
+		}
+	}
+
+	if h := c.PreRun; h != nil {
+		c.PreRun = func(cmd *cobra.Command, args []string) {
+			b.applyFlags(cmd)
+			h(cmd, args)
+		}
+	}
+}
+
 func (b *cobraBuilder) setHandler(h HandlerFunc) {
 	b._cmd.RunE = func(c *cobra.Command, args []string) error {
+		logFlags(c)
+		b.applyFlags(c)
+
 		if h != nil {
 			return h(c, args)
 		}
@@ -215,7 +433,18 @@ func (b *cobraBuilder) setHandler(h HandlerFunc) {
 
 func (b *cobraBuilder) addChildCommands(bC builderCallback, cfg interface{}, children ...Command) error {
 	for _, c := range children {
-		cmd, err := bC().Build(c, cfg)
+		child := bC()
+
+		if cb, ok := child.(*cobraBuilder); ok {
+			if b._bound == nil {
+				b._bound = map[*pflag.Flag]*boundFlag{}
+			}
+
+			cb._bound = b._bound
+			cb._defaults = b._defaults
+		}
+
+		cmd, err := child.Build(c, cfg)
 
 		if err != nil {
 			return err
@@ -240,8 +469,12 @@ func (b *cobraBuilder) customConfigure(f func(*cobra.Command)) {
 }
 
 func (b *cobraBuilder) Build(cmd Command, cfg interface{}) (interface{}, error) {
+	// the config is only used to find secrets, so an invalid one is ignored
+	b._fields, _ = collectConfigFields(cfg, "")
+
 	b.setName(cmd.Name)
 	b.setDescriptions(cmd.Descriptions.Short, cmd.Descriptions.Long)
+	configureCommand(b._cmd, cmd)
 
 	err := b.addPersistentFlags(cmd.PersistentFlags...)
 
@@ -266,5 +499,7 @@ func (b *cobraBuilder) Build(cmd Command, cfg interface{}) (interface{}, error)
 		b.customConfigure(cmd.CustomConfiguration)
 	}
 
+	b.applyFlagsBeforeHooks()
+
 	return b._cmd, nil
 }
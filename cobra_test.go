@@ -1,9 +1,13 @@
 package clapp
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"testing"
 
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -933,3 +937,185 @@ func TestCobraBuidler_customConfigure(t *testing.T) {
 
 	assert.Equal(t, "blah", cb._cmd.Use)
 }
+
+func TestCobraBuilder_Build_MasksSecretFlags(t *testing.T) {
+	cfg := &testSecretConf{
+		Password: "hunter2",
+	}
+	other := "visible"
+	apiKey := "letmein"
+
+	cmd, err := newCobraBuilder().Build(Command{
+		Name: "secretive",
+		PersistentFlags: []Flag{
+			{
+				Name:     "password",
+				ValueRef: &cfg.Password,
+				Type:     StringFlag,
+			},
+		},
+		LocalFlags: []Flag{
+			{
+				Name:     "other",
+				ValueRef: &other,
+				Type:     StringFlag,
+			},
+			{
+				Name:     "api-key",
+				ValueRef: &apiKey,
+				Type:     StringFlag,
+				Secret:   true,
+			},
+		},
+	}, cfg)
+
+	assert.Nil(t, err)
+
+	c := cmd.(*cobra.Command)
+
+	password := c.PersistentFlags().Lookup("password")
+	assert.Equal(t, SecretMask, password.DefValue)
+	assert.Contains(t, password.Annotations, secretFlagAnnotation)
+
+	apiKeyFlag := c.Flags().Lookup("api-key")
+	assert.Equal(t, SecretMask, apiKeyFlag.DefValue)
+	assert.Contains(t, apiKeyFlag.Annotations, secretFlagAnnotation)
+
+	otherFlag := c.Flags().Lookup("other")
+	assert.Equal(t, "visible", otherFlag.DefValue)
+	assert.NotContains(t, otherFlag.Annotations, secretFlagAnnotation)
+}
+
+func TestLogFlags_MasksSecrets(t *testing.T) {
+	cfg := &testSecretConf{}
+	b := new(bytes.Buffer)
+
+	cmd, err := newCobraBuilder().Build(Command{
+		Name: "secretive",
+		LocalFlags: []Flag{
+			{
+				Name:     "password",
+				ValueRef: &cfg.Password,
+				Type:     StringFlag,
+			},
+			{
+				Name:     "username",
+				ValueRef: &cfg.Username,
+				Type:     StringFlag,
+			},
+		},
+		Handle: func(c *cobra.Command, args []string) error {
+			return nil
+		},
+	}, cfg)
+
+	assert.Nil(t, err)
+
+	c := cmd.(*cobra.Command)
+	c.SetArgs([]string{"--password", "hunter2", "--username", "admin"})
+
+	ctx := contextWithLogger(context.TODO(), zerolog.New(b))
+	assert.Nil(t, c.ExecuteContext(ctx))
+
+	assert.NotContains(t, b.String(), "hunter2")
+	assert.Contains(t, b.String(), `"flag":"password","value":"******"`)
+	assert.Contains(t, b.String(), `"flag":"username","value":"admin"`)
+}
+
+func TestCobraExecutor_FlagsOverrideOnlyWhenGiven(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/flags.yaml", []byte("should-do-that: from-file\nlist-of-things: [file]\n"), 0644))
+
+	tests := []struct {
+		name         string
+		args         []string
+		expected     testConf
+		expectedHelp []string
+	}{
+		{
+			name: "file values are kept when flags are not given",
+			args: []string{},
+			expected: testConf{
+				ShouldDoThat:     "from-file",
+				ShouldEnableThis: "builtin",
+				ListOfThings:     []string{"file"},
+			},
+		},
+		{
+			name: "given flags replace file values",
+			args: []string{"--do-that", "from-flag", "--things", "a,b"},
+			expected: testConf{
+				ShouldDoThat:     "from-flag",
+				ShouldEnableThis: "builtin",
+				ListOfThings:     []string{"a", "b"},
+			},
+		},
+		{
+			name: "help shows the effective and built in defaults",
+			args: []string{"--help"},
+			expectedHelp: []string{
+				`--do-that string       Do that (built-in default "builtin-that") (default "from-file")`,
+				`--enable-this string   Enable this (default "builtin")`,
+				`--things strings       Things (built-in default []) (default [file])`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			cfg := &testConf{
+				ShouldDoThat:     "builtin-that",
+				ShouldEnableThis: "builtin",
+			}
+			out := &bytes.Buffer{}
+
+			err := Run(App{
+				Config:     cfg,
+				ConfigPath: "/flags.yaml",
+				Fs:         fs,
+				Args:       test.args,
+				RootCommand: Command{
+					Name: "flags",
+					LocalFlags: []Flag{
+						{
+							Name:        "do-that",
+							Description: "Do that",
+							ValueRef:    &cfg.ShouldDoThat,
+							Type:        StringFlag,
+						},
+						{
+							Name:        "enable-this",
+							Description: "Enable this",
+							ValueRef:    &cfg.ShouldEnableThis,
+							Type:        StringFlag,
+						},
+						{
+							Name:        "things",
+							Description: "Things",
+							ValueRef:    &cfg.ListOfThings,
+							Type:        StringSliceFlag,
+						},
+					},
+					Handle: func(cmd *cobra.Command, args []string) error {
+						return nil
+					},
+					CustomConfiguration: func(cmd *cobra.Command) {
+						cmd.SetOut(out)
+					},
+				},
+			}, NewCobraExecutor())
+
+			assert.Nil(tt, err)
+
+			if test.expectedHelp != nil {
+				for _, line := range test.expectedHelp {
+					assert.Contains(tt, out.String(), line)
+				}
+
+				return
+			}
+
+			assert.Equal(tt, test.expected, *cfg)
+		})
+	}
+}
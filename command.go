@@ -28,6 +28,16 @@ type Flag struct {
 	ValueRef    interface{}
 	Type        ValueType
 	Required    bool
+
+	// Secret masks the flag's value in help and logs, flags bound to a
+	// secret config field are masked automatically
+	Secret bool
+}
+
+// CommandGroup is a heading that child commands are listed under in help.
+type CommandGroup struct {
+	ID    string
+	Title string
 }
 
 type Command struct {
@@ -38,6 +48,43 @@ type Command struct {
 	Handle              HandlerFunc
 	CustomConfiguration func(*cobra.Command)
 	Children            []Command
+
+	// Aliases can be used in place of Name to run the command
+	Aliases []string
+
+	// Hidden commands can be run but are left out of help and docs
+	Hidden bool
+
+	// Deprecated is shown when the command is run, the command is left out of
+	// help
+	Deprecated string
+
+	// Example is shown in help, indent it as it should be shown
+	Example string
+
+	// Group is the ID of one of the parent's Groups to list the command under
+	// in help
+	Group string
+
+	// Groups are the headings for children in help, in the order given.
+	// Children without a Group are listed after them.
+	Groups []CommandGroup
+
+	// Config is a pointer to a struct loaded from the ConfigKey section of
+	// the config file, and env vars with the EnvPrefix sub prefix, only when
+	// this command runs. See CommandConfigFromContext.
+	Config interface{}
+
+	// ConfigKey defaults to the command's name
+	ConfigKey string
+
+	// EnvPrefix follows the app's prefix e.g. APP_SERVER_PORT, it defaults to
+	// the ConfigKey
+	EnvPrefix string
+
+	// Middleware wraps Handle, and the handlers of all children, inside the
+	// middleware of the parent commands
+	Middleware []Middleware
 }
 
 type Executor interface {
@@ -0,0 +1,195 @@
+package clapp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const CommandConfigContextKey ContextKey = "COMMAND_CONFIG"
+
+// CommandConfigFromContext returns the Config of the command that is running,
+// or nil if it doesn't have one.
+func CommandConfigFromContext(ctx context.Context) interface{} {
+	if h, ok := ctx.Value(CommandConfigContextKey).(*configHolder); ok {
+		return h.Load()
+	}
+
+	return nil
+}
+
+func contextWithCommandConfig(ctx context.Context) context.Context {
+	return context.WithValue(
+		ctx,
+		CommandConfigContextKey,
+		&configHolder{},
+	)
+}
+
+func (cmd Command) configKey() string {
+	if cmd.ConfigKey != "" {
+		return cmd.ConfigKey
+	}
+
+	return cmd.Name
+}
+
+func (cmd Command) envPrefix() string {
+	if cmd.EnvPrefix != "" {
+		return cmd.EnvPrefix
+	}
+
+	return sanitiseEnvPrefix(cmd.configKey())
+}
+
+// sectionDocument returns a document holding only the value under key in the
+// root mapping of doc, the document is empty if the key is not there.
+func sectionDocument(doc *yaml.Node, key string) yaml.Node {
+	section := yaml.Node{
+		Kind: yaml.DocumentNode,
+	}
+
+	if n := findYAMLNode(doc, []string{key}); n != nil {
+		section.Content = []*yaml.Node{n}
+	}
+
+	return section
+}
+
+// removeRootKeys removes the keys from the root mapping of doc.
+func removeRootKeys(doc *yaml.Node, keys []string) {
+	if len(keys) == 0 || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return
+	}
+
+	root := doc.Content[0]
+
+	for _, key := range keys {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == key {
+				root.Content = append(root.Content[:i], root.Content[i+2:]...)
+				break
+			}
+		}
+	}
+}
+
+func commandSectionsOpt(cmds []Command) configOpt {
+	return func(c *Config) {
+		c.sectionCommands = cmds
+	}
+}
+
+// commandsWithConfig finds every command in the tree that has its own config.
+func commandsWithConfig(cmd Command) []Command {
+	cmds := []Command{}
+
+	if cmd.Config != nil {
+		cmds = append(cmds, cmd)
+	}
+
+	for _, child := range cmd.Children {
+		cmds = append(cmds, commandsWithConfig(child)...)
+	}
+
+	return cmds
+}
+
+func (c *Config) sectionKeys() []string {
+	keys := []string{}
+
+	for _, cmd := range c.sectionCommands {
+		keys = append(keys, cmd.configKey())
+	}
+
+	return keys
+}
+
+func (c *Config) commandEnvPrefix(cmd Command) string {
+	if c.envPrefix == "" {
+		return cmd.envPrefix()
+	}
+
+	return fmt.Sprintf("%s_%s", c.envPrefix, cmd.envPrefix())
+}
+
+// LoadCommandConfig decodes the command's section of the config file into
+// into, then overrides it with env vars that have the command's sub prefix
+// e.g. APP_SERVER_PORT. into is validated if it implements ConfigValidator.
+func (c *Config) LoadCommandConfig(cmd Command, into interface{}) error {
+	if reflect.ValueOf(into).Kind() != reflect.Ptr {
+		return ErrConfigMustBeAPointer
+	}
+
+	section := c.snapshot()
+	section.section = cmd.configKey()
+	section.live = nil
+
+	if err := section.load(into); err != nil {
+		return err
+	}
+
+	prefix := c.commandEnvPrefix(cmd)
+
+	if err := redactEnvError(processEnv(prefix, c.envNaming, into, c.getenv), into, prefix, c.envNaming); err != nil {
+		return ErrOverridingConfigWithEnvFailed{
+			wrapped: err,
+		}
+	}
+
+	if v, ok := into.(ConfigValidator); ok {
+		if err := v.Validate(); err != nil {
+			return ErrInvalidConfig{
+				wrapped: err,
+			}
+		}
+	}
+
+	return nil
+}
+
+// withCommandConfigs wraps the handler of every command that has a Config so
+// it is loaded just before the command runs. Values given by flags bound to
+// the command's config are kept.
+func withCommandConfigs(cmd Command) Command {
+	children := make([]Command, len(cmd.Children))
+	for i, child := range cmd.Children {
+		children[i] = withCommandConfigs(child)
+	}
+
+	cmd.Children = children
+
+	if cmd.Config == nil || cmd.Handle == nil {
+		return cmd
+	}
+
+	defaults := deepCopy(cmd.Config)
+	handle := cmd.Handle
+	current := cmd
+
+	cmd.Handle = func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		loaded := deepCopy(defaults)
+
+		if err := ConfigManagerFromContext(ctx).LoadCommandConfig(current, loaded); err != nil {
+			return ErrLoadingCommandConfig{
+				Command: current.Name,
+				wrapped: err,
+			}
+		}
+
+		ConfigManagerFromContext(ctx).overrideWithFlags(current.Config, loaded)
+		reflect.ValueOf(current.Config).Elem().Set(reflect.ValueOf(loaded).Elem())
+
+		if h, ok := ctx.Value(CommandConfigContextKey).(*configHolder); ok {
+			h.Swap(current.Config)
+		}
+
+		return handle(c, args)
+	}
+
+	return cmd
+}
@@ -0,0 +1,132 @@
+package clapp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type testServerConf struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port" envconfig:"PORT"`
+	TLS  bool   `yaml:"tls"`
+}
+
+type testMigrateConf struct {
+	Steps int `yaml:"steps"`
+}
+
+func (c *testMigrateConf) Validate() error {
+	if c.Steps < 0 {
+		return errors.New("steps cannot be negative")
+	}
+
+	return nil
+}
+
+func buildCommandConfigApp(fs afero.Fs, args []string, got *[]interface{}) (App, *testServerConf) {
+	server := &testServerConf{
+		Host: "localhost",
+	}
+
+	capture := func(cmd *cobra.Command, args []string) error {
+		*got = append(*got, CommandConfigFromContext(cmd.Context()))
+		return nil
+	}
+
+	return App{
+		Config:       &testConf{},
+		ConfigPath:   "/multi.yaml",
+		Fs:           fs,
+		Args:         args,
+		StrictConfig: true,
+		Environ: Environ{
+			"MULTI_SERVER_PORT": "9090",
+			"MULTI_MIG_STEPS":   "-2",
+		},
+		UnknownEnvVars: ErrorOnUnknownEnvVars,
+		RootCommand: Command{
+			Name:   "multi",
+			Handle: capture,
+			Children: []Command{
+				{
+					Name:   "server",
+					Config: server,
+					Handle: capture,
+					LocalFlags: []Flag{
+						{
+							Name:     "host",
+							ValueRef: &server.Host,
+							Type:     StringFlag,
+						},
+					},
+				},
+				{
+					Name:      "migrate",
+					Config:    &testMigrateConf{},
+					ConfigKey: "migrations",
+					EnvPrefix: "MIG",
+					Handle:    capture,
+				},
+			},
+		},
+	}, server
+}
+
+func TestRun_CommandConfig(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/multi.yaml", []byte(`should-do-that: app
+server:
+  host: file-host
+  port: 8080
+  tls: true
+migrations:
+  steps: 5
+`), 0644))
+
+	got := []interface{}{}
+	app, server := buildCommandConfigApp(fs, []string{"server", "--host", "flag-host"}, &got)
+
+	assert.Nil(t, Run(app, NewCobraExecutor()))
+	assert.Equal(t, []interface{}{
+		&testServerConf{
+			Host: "flag-host",
+			Port: 9090,
+			TLS:  true,
+		},
+	}, got)
+	assert.Same(t, server, got[0])
+	assert.Equal(t, "app", app.Config.(*testConf).ShouldDoThat)
+
+	// the migrate section is only loaded and validated when it runs
+	got = []interface{}{}
+	app, _ = buildCommandConfigApp(fs, []string{"migrate"}, &got)
+	err := Run(app, NewCobraExecutor())
+
+	assert.IsType(t, ErrLoadingCommandConfig{}, err)
+	assert.Equal(t, "failed to load config for command migrate: config is not valid: steps cannot be negative", err.Error())
+
+	// commands without a config have none in the context
+	got = []interface{}{}
+	app, _ = buildCommandConfigApp(fs, []string{}, &got)
+
+	assert.Nil(t, Run(app, NewCobraExecutor()))
+	assert.Equal(t, []interface{}{nil}, got)
+}
+
+func TestRun_CommandConfigStrict(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/multi.yaml", []byte(`server:
+  unknown: value
+`), 0644))
+
+	got := []interface{}{}
+	app, _ := buildCommandConfigApp(fs, []string{"server"}, &got)
+	err := Run(app, NewCobraExecutor())
+
+	assert.IsType(t, ErrLoadingCommandConfig{}, err)
+	assert.IsType(t, ErrUnmarshallingYAML{}, errors.Unwrap(err))
+}
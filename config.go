@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/kelseyhightower/envconfig"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
@@ -16,9 +21,31 @@ var ErrConfigNotFound error = errors.New("config file does not exist")
 
 type Config struct {
 	filePath        string
+	layers          []string
 	appName         string
 	fs              afero.Fs
 	configMustExist bool
+	validateSchema  bool
+	strict          bool
+	resolveRefs     bool
+	resolvers       []Resolver
+	profile         string
+	sources         []Source
+	sourcesCtx      context.Context
+	dotEnv          map[string]string
+	environ         Environ
+	envPrefix       string
+	envNaming       EnvNaming
+
+	// section is the key of the only part of the file that is loaded, when
+	// loading a command's config. The sections of sectionCommands are not
+	// loaded into the app's config.
+	section         string
+	sectionCommands []Command
+
+	// flagRefs are the ValueRefs of flags that were given on the command line
+	flagRefs []interface{}
+	live     *liveConfig
 }
 
 type configOpt func(c *Config)
@@ -35,25 +62,444 @@ func FileMustExistOpt() configOpt {
 	}
 }
 
-func (c *Config) load(into interface{}) error {
-	if exists, err := afero.Exists(c.fs, c.filePath); !exists || err != nil {
-		return ErrConfigNotFound
+// EnvironOpt reads environment variables from env rather than the process
+// environment.
+func EnvironOpt(env Environ) configOpt {
+	return func(c *Config) {
+		c.environ = env
+	}
+}
+
+// EnvPrefixOpt sets the prefix of env vars, by default this is derived from
+// the app's name.
+func EnvPrefixOpt(prefix string) configOpt {
+	return func(c *Config) {
+		c.envPrefix = prefix
 	}
+}
 
-	cfgBytes, err := afero.ReadFile(c.fs, c.filePath)
+func EnvNamingOpt(naming EnvNaming) configOpt {
+	return func(c *Config) {
+		c.envNaming = naming
+	}
+}
 
-	if err != nil {
-		return ErrReadingFile{
+// LayeredFilesOpt loads each file in order, values in later files override
+// those in earlier ones. Every file must exist.
+func LayeredFilesOpt(paths ...string) configOpt {
+	return func(c *Config) {
+		if len(paths) == 0 {
+			return
+		}
+
+		c.filePath = paths[0]
+		c.layers = paths[1:]
+		c.configMustExist = true
+	}
+}
+
+func ValidateSchemaOpt() configOpt {
+	return func(c *Config) {
+		c.validateSchema = true
+	}
+}
+
+func StrictOpt() configOpt {
+	return func(c *Config) {
+		c.strict = true
+	}
+}
+
+// ResolveReferencesOpt expands ${VAR} style variables in the config file and
+// resolves values such as file:///run/secrets/db or env:VAR after decoding.
+// The given resolvers take precedence over the built in file and env ones.
+func ResolveReferencesOpt(resolvers ...Resolver) configOpt {
+	return func(c *Config) {
+		c.resolveRefs = true
+		c.resolvers = resolvers
+	}
+}
+
+// decode decodes doc into into, rather than the file's bytes, so that the
+// positions in errors are those of the file even after it has been expanded or
+// had keys removed.
+func (c *Config) decode(doc *yaml.Node, into interface{}) error {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	errs := []string{}
+
+	// yaml.Node.Decode can't be told to reject unknown fields, so they are
+	// found first with the same messages yaml.Decoder.KnownFields would give
+	if c.strict {
+		errs = unknownYAMLFields(doc, reflect.TypeOf(into))
+	}
+
+	err := doc.Decode(into)
+
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		errs = append(errs, typeErr.Errors...)
+	} else if err != nil {
+		return err
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return yamlErrorLine(errs[i]) < yamlErrorLine(errs[j])
+	})
+
+	return &yaml.TypeError{
+		Errors: errs,
+	}
+}
+
+func yamlErrorLine(msg string) int {
+	line := 0
+
+	if m := yamlPositionRegexp.FindStringSubmatch(msg); m != nil {
+		line, _ = strconv.Atoi(m[1])
+	}
+
+	return line
+}
+
+// unknownYAMLFields lists the keys in n that have no field in t, following
+// the rules yaml uses to match keys to fields.
+func unknownYAMLFields(n *yaml.Node, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	unknown := []string{}
+
+	// types that decode themselves may accept any keys
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) {
+		return unknown
+	}
+
+	switch {
+	case n.Kind == yaml.DocumentNode:
+		for _, c := range n.Content {
+			unknown = append(unknown, unknownYAMLFields(c, t)...)
+		}
+	case n.Kind == yaml.SequenceNode && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+		for _, c := range n.Content {
+			unknown = append(unknown, unknownYAMLFields(c, t.Elem())...)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(n.Content); i += 2 {
+			unknown = append(unknown, unknownYAMLFields(n.Content[i], t.Elem())...)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields, inlineMap := yamlFieldTypes(t)
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+
+			if k.Tag == "!!merge" {
+				continue
+			}
+
+			if ft, ok := fields[k.Value]; ok {
+				unknown = append(unknown, unknownYAMLFields(n.Content[i+1], ft)...)
+			} else if !inlineMap {
+				unknown = append(unknown, fmt.Sprintf("line %d: field %s not found in type %s", k.Line, k.Value, t))
+			}
+		}
+	}
+
+	return unknown
+}
+
+// yamlFieldTypes returns the types of the fields of t keyed by the name yaml
+// gives them, and whether it has an inline map that takes any other keys.
+func yamlFieldTypes(t reflect.Type) (map[string]reflect.Type, bool) {
+	fields := map[string]reflect.Type{}
+	inlineMap := false
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := f.Tag.Get("yaml")
+		if tag == "" && !strings.Contains(string(f.Tag), ":") {
+			tag = string(f.Tag)
+		}
+
+		if tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		inline := false
+		for _, o := range opts[1:] {
+			inline = inline || o == "inline"
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case inline && ft.Kind() == reflect.Map:
+			inlineMap = true
+		case inline && ft.Kind() == reflect.Struct:
+			inner, innerMap := yamlFieldTypes(ft)
+
+			for k, v := range inner {
+				fields[k] = v
+			}
+
+			inlineMap = inlineMap || innerMap
+		default:
+			fields[name] = f.Type
+		}
+	}
+
+	return fields, inlineMap
+}
+
+var yamlPositionRegexp = regexp.MustCompile(`line (\d+)(?:: column (\d+))?`)
+
+func newErrUnmarshallingYAML(err error) ErrUnmarshallingYAML {
+	e := ErrUnmarshallingYAML{
+		wrapped: err,
+	}
+
+	if m := yamlPositionRegexp.FindStringSubmatch(err.Error()); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Column, _ = strconv.Atoi(m[2])
+	}
+
+	return e
+}
+
+func (c *Config) readFile(path string) ([]byte, error) {
+	return readConfigFile(c.fs, path)
+}
+
+func readConfigFile(fs afero.Fs, path string) ([]byte, error) {
+	info, err := fs.Stat(path)
+
+	switch {
+	case os.IsNotExist(err):
+		return nil, ErrConfigFileNotFound{
+			Path:    path,
+			wrapped: err,
+		}
+	case os.IsPermission(err):
+		return nil, ErrConfigPermissionDenied{
+			Path:    path,
+			wrapped: err,
+		}
+	case err != nil:
+		return nil, ErrReadingFile{
+			wrapped: err,
+		}
+	case info.IsDir():
+		return nil, ErrConfigIsDirectory{
+			Path: path,
+		}
+	}
+
+	cfgBytes, err := afero.ReadFile(fs, path)
+
+	if os.IsPermission(err) {
+		return nil, ErrConfigPermissionDenied{
+			Path:    path,
 			wrapped: err,
 		}
 	}
 
-	if err := yaml.Unmarshal(cfgBytes, into); err != nil {
-		return ErrUnmarshallingYAML{
+	if err != nil {
+		return nil, ErrReadingFile{
 			wrapped: err,
 		}
 	}
 
+	return cfgBytes, nil
+}
+
+const includeKey string = "include"
+
+// ProfileOpt overlays <name>.<profile>.yaml on top of the config file.
+func ProfileOpt(profile string) configOpt {
+	return func(c *Config) {
+		c.profile = profile
+	}
+}
+
+func profilePath(path string, profile string) string {
+	ext := filepath.Ext(path)
+
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(path, ext), profile, ext)
+}
+
+// extractIncludes removes the include directive from the root of the document
+// returning the paths it listed, relative to the including file.
+func extractIncludes(doc *yaml.Node, from string) ([]string, error) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	paths := []string{}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != includeKey {
+			continue
+		}
+
+		v := root.Content[i+1]
+
+		switch v.Kind {
+		case yaml.ScalarNode:
+			paths = append(paths, v.Value)
+		case yaml.SequenceNode:
+			for _, item := range v.Content {
+				paths = append(paths, item.Value)
+			}
+		default:
+			return nil, ErrUnmarshallingYAML{
+				Line:    v.Line,
+				Column:  v.Column,
+				wrapped: fmt.Errorf("line %d: %s must be a path or list of paths", v.Line, includeKey),
+			}
+		}
+
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		break
+	}
+
+	for i, p := range paths {
+		if !filepath.IsAbs(p) {
+			paths[i] = filepath.Join(filepath.Dir(from), p)
+		}
+	}
+
+	return paths, nil
+}
+
+// loadFile decodes path into the config, after first decoding any files that
+// it includes. chain holds the files currently being loaded to detect cycles.
+func (c *Config) loadFile(path string, into interface{}, chain []string) error {
+	for _, p := range chain {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return ErrConfigIncludeCycle{
+				Chain: append(append([]string{}, chain...), path),
+			}
+		}
+	}
+
+	chain = append(chain, path)
+
+	c.trackFile(path)
+
+	cfgBytes, err := c.readFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	doc := yaml.Node{}
+
+	if err := yaml.Unmarshal(cfgBytes, &doc); err != nil {
+		return newErrUnmarshallingYAML(err)
+	}
+
+	// scalars are expanded in place so they keep their positions in the file
+	if c.resolveRefs {
+		if err := expandNode(&doc, c.getenv); err != nil {
+			return err
+		}
+	}
+
+	includes, err := extractIncludes(&doc, path)
+
+	if err != nil {
+		return err
+	}
+
+	for _, inc := range includes {
+		if err := c.loadFile(inc, into, chain); err != nil {
+			return err
+		}
+	}
+
+	if c.section != "" {
+		doc = sectionDocument(&doc, c.section)
+	} else {
+		removeRootKeys(&doc, c.sectionKeys())
+	}
+
+	if c.validateSchema && len(doc.Content) > 0 {
+		schema, err := NewConfigSchema(into)
+
+		if err != nil {
+			return err
+		}
+
+		if err := validateDocument(schema, &doc); err != nil {
+			return err
+		}
+	}
+
+	if err := c.decode(&doc, into); err != nil {
+		if unknown, ok := newErrUnknownConfigKeys(err, &doc, into); ok {
+			return newErrUnmarshallingYAML(unknown)
+		}
+
+		return newErrUnmarshallingYAML(redactYAMLError(err, &doc, into))
+	}
+
+	return nil
+}
+
+func (c *Config) load(into interface{}) error {
+	err := c.loadFile(c.filePath, into, nil)
+
+	// Only the main file is optional, missing includes or profiles are errors
+	notFound := ErrConfigFileNotFound{}
+	if errors.As(err, &notFound) && notFound.Path == c.filePath && !c.configMustExist {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range c.layers {
+		if err := c.loadFile(layer, into, nil); err != nil {
+			return err
+		}
+	}
+
+	if c.profile != "" {
+		if err := c.loadFile(profilePath(c.filePath, c.profile), into, nil); err != nil {
+			return err
+		}
+	}
+
+	if c.resolveRefs {
+		resolvers := append(append([]Resolver{}, c.resolvers...), defaultResolvers(c.fs, c.getenv)...)
+
+		return resolveRefs(reflect.ValueOf(into), resolvers)
+	}
+
 	return nil
 }
 
@@ -64,15 +510,88 @@ func (c *Config) OverrideWithEnvVars(cfg interface{}) error {
 		return ErrCannotUseNonPointerValue
 	}
 
-	return envconfig.Process(c.appName, cfg)
+	return redactEnvError(processEnv(c.envPrefix, c.envNaming, cfg, c.getenv), cfg, c.envPrefix, c.envNaming)
+}
+
+// getenv looks up a variable in the environment, falling back to any that
+// were loaded from .env files.
+func (c *Config) getenv(key string) (string, bool) {
+	if v, ok := lookupEnvFunc(c.environ)(key); ok {
+		return v, true
+	}
+
+	v, ok := c.dotEnvVars()[key]
+
+	return v, ok
+}
+
+// UnknownEnvVars returns any variables in the environment that share the
+// app's prefix but do not map to a field in cfg.
+func (c *Config) UnknownEnvVars(cfg interface{}) ([]string, error) {
+	fields, err := collectEnvConfigFields(cfg, c.envPrefix, c.envNaming)
+
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.EnvVar] = true
+	}
+
+	prefix := fmt.Sprintf("%s_", strings.ToUpper(c.envPrefix))
+	unknown := []string{}
+
+	for _, name := range builtinEnvVars {
+		known[prefix+name] = true
+	}
+
+	for _, cmd := range c.sectionCommands {
+		cmdFields, err := collectEnvConfigFields(cmd.Config, c.commandEnvPrefix(cmd), c.envNaming)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range cmdFields {
+			known[f.EnvVar] = true
+		}
+	}
+
+	env := c.environ
+	if env == nil {
+		env = OsEnviron()
+	}
+
+	names := env.Names()
+
+	// variables from a .env file are only known once the sources have run
+	for name := range c.dotEnvVars() {
+		if _, set := env.Lookup(name); !set {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	sort.Strings(unknown)
+
+	return unknown, nil
 }
 
-func newConfigManager(ctx context.Context, cfg interface{}, appName string, filePath string, mustExist bool) (*Config, error) {
+// buildConfigManager creates the manager without loading anything into the
+// config, Run does that by running the sources.
+func buildConfigManager(ctx context.Context, appName string, filePath string, mustExist bool, opts ...configOpt) *Config {
 	c := &Config{
 		appName:         appName,
 		fs:              FsFromContext(ctx),
 		configMustExist: false,
 		filePath:        fmt.Sprintf("./%s.yaml", appName),
+		envPrefix:       sanitiseEnvPrefix(appName),
 	}
 
 	if filePath != "" {
@@ -83,11 +602,15 @@ func newConfigManager(ctx context.Context, cfg interface{}, appName string, file
 		FileMustExistOpt()(c)
 	}
 
-	err := c.load(cfg)
-
-	if !c.configMustExist && err == ErrConfigNotFound {
-		return c, nil
+	for _, opt := range opts {
+		opt(c)
 	}
 
-	return c, err
+	return c
+}
+
+func newConfigManager(ctx context.Context, cfg interface{}, appName string, filePath string, mustExist bool, opts ...configOpt) (*Config, error) {
+	c := buildConfigManager(ctx, appName, filePath, mustExist, opts...)
+
+	return c, c.load(cfg)
 }
@@ -1,9 +1,11 @@
 package clapp
 
 import (
+	"errors"
 	"os"
 	"testing"
 
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +26,7 @@ func TestNewConfig(t *testing.T) {
 		fileMustExist         bool
 		expectedConfig        Config
 		expectedErr           error
+		expectedErrIs         error
 		expectedErrTxt        string
 		opts                  []configOpt
 	}{
@@ -36,6 +39,7 @@ func TestNewConfig(t *testing.T) {
 				appName:         "blah",
 				filePath:        "./blah.yaml",
 				fs:              fs,
+				envPrefix:       "BLAH",
 				configMustExist: false,
 			},
 			expectedErr: nil,
@@ -50,6 +54,7 @@ func TestNewConfig(t *testing.T) {
 				appName:         "blah",
 				filePath:        "/tmp/some/dir/blah.yaml",
 				fs:              fs,
+				envPrefix:       "BLAH",
 				configMustExist: false,
 			},
 			expectedErr: nil,
@@ -64,9 +69,10 @@ func TestNewConfig(t *testing.T) {
 				appName:         "blah",
 				filePath:        "./blah.yaml",
 				fs:              fs,
+				envPrefix:       "BLAH",
 				configMustExist: true,
 			},
-			expectedErr: ErrConfigNotFound,
+			expectedErrIs: ErrConfigNotFound,
 		},
 		{
 			name:                  "multiple options are applied",
@@ -79,9 +85,10 @@ func TestNewConfig(t *testing.T) {
 				appName:         "blah",
 				filePath:        "/tmp/some/dir/blah.yaml",
 				fs:              fs,
+				envPrefix:       "BLAH",
 				configMustExist: true,
 			},
-			expectedErr: ErrConfigNotFound,
+			expectedErrIs: ErrConfigNotFound,
 		},
 		{
 			name:      "values should be overridden from file",
@@ -107,6 +114,7 @@ func TestNewConfig(t *testing.T) {
 				appName:         "blah",
 				filePath:        validConfigPath,
 				fs:              fs,
+				envPrefix:       "BLAH",
 				configMustExist: false,
 			},
 			expectedErr: nil,
@@ -122,20 +130,129 @@ func TestNewConfig(t *testing.T) {
 				appName:         "blah",
 				filePath:        invalidConfigPath,
 				fs:              fs,
+				envPrefix:       "BLAH",
 				configMustExist: false,
 			},
 			expectedErrTxt: "could not unmarshal config: ",
 		},
+		{
+			name:      "valid file passes schema validation",
+			inputConf: &testConf{},
+			expectedConfStructure: testConf{
+				ShouldEnableThis: "awesome-feature",
+				ShouldDoThat:     "work-properly",
+				ExternalEndpoint: testExtEndpoint{
+					Protocol: "https",
+					Domain:   "somefakesite.com",
+					Port:     6738,
+				},
+				ListOfThings: []string{
+					"thing1",
+					"thing2",
+					"thing3",
+				},
+			},
+			appName:  "blah",
+			filePath: validConfigPath,
+			opts: []configOpt{
+				ValidateSchemaOpt(),
+			},
+			expectedConfig: Config{
+				appName:         "blah",
+				filePath:        validConfigPath,
+				fs:              fs,
+				envPrefix:       "BLAH",
+				configMustExist: false,
+				validateSchema:  true,
+			},
+			expectedErr: nil,
+		},
+		{
+			name:                  "schema violations are returned before decoding",
+			inputConf:             &testConf{},
+			expectedConfStructure: testConf{},
+			appName:               "blah",
+			filePath:              unknownKeyConfigPath,
+			opts: []configOpt{
+				ValidateSchemaOpt(),
+			},
+			expectedConfig: Config{
+				appName:         "blah",
+				filePath:        unknownKeyConfigPath,
+				fs:              fs,
+				envPrefix:       "BLAH",
+				configMustExist: false,
+				validateSchema:  true,
+			},
+			expectedErrTxt: "config does not match schema: line 2, column 1: should-do-this: unknown key",
+		},
+		{
+			name:      "strict option rejects unknown keys",
+			inputConf: &testConf{},
+			// known keys are still decoded before the error is returned
+			expectedConfStructure: testConf{
+				ShouldEnableThis: "awesome-feature",
+			},
+			appName:  "blah",
+			filePath: unknownKeyConfigPath,
+			opts: []configOpt{
+				StrictOpt(),
+			},
+			expectedConfig: Config{
+				appName:         "blah",
+				filePath:        unknownKeyConfigPath,
+				fs:              fs,
+				envPrefix:       "BLAH",
+				configMustExist: false,
+				strict:          true,
+			},
+			expectedErrTxt: `line 2: unknown config key "should-do-this", did you mean "should-do-that"?`,
+		},
+		{
+			name:      "strict option accepts known keys",
+			inputConf: &testConf{},
+			expectedConfStructure: testConf{
+				ShouldEnableThis: "awesome-feature",
+				ShouldDoThat:     "work-properly",
+				ExternalEndpoint: testExtEndpoint{
+					Protocol: "https",
+					Domain:   "somefakesite.com",
+					Port:     6738,
+				},
+				ListOfThings: []string{
+					"thing1",
+					"thing2",
+					"thing3",
+				},
+			},
+			appName:  "blah",
+			filePath: validConfigPath,
+			opts: []configOpt{
+				StrictOpt(),
+			},
+			expectedConfig: Config{
+				appName:         "blah",
+				filePath:        validConfigPath,
+				fs:              fs,
+				envPrefix:       "BLAH",
+				configMustExist: false,
+				strict:          true,
+			},
+			expectedErr: nil,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(tt *testing.T) {
-			cfg, err := newConfigManager(ctx, test.inputConf, test.appName, test.filePath, test.fileMustExist)
+			cfg, err := newConfigManager(ctx, test.inputConf, test.appName, test.filePath, test.fileMustExist, test.opts...)
 
-			if test.expectedErrTxt == "" {
-				assert.Equal(tt, test.expectedErr, err)
-			} else {
+			switch {
+			case test.expectedErrIs != nil:
+				assert.True(tt, errors.Is(err, test.expectedErrIs), "expected %v to be %v", err, test.expectedErrIs)
+			case test.expectedErrTxt != "":
 				assert.Contains(tt, err.Error(), test.expectedErrTxt)
+			default:
+				assert.Equal(tt, test.expectedErr, err)
 			}
 			assert.Equal(tt, test.expectedConfig, *cfg)
 			assert.Equal(tt, test.expectedConfStructure, *test.inputConf)
@@ -212,3 +329,158 @@ func TestNewConfig_OverrideWithEnv(t *testing.T) {
 		},
 	}, *inputConf)
 }
+
+func TestConfig_UnknownEnvVars(t *testing.T) {
+	ctx := contextStub{
+		Vals: map[interface{}]interface{}{
+			FsContextKey: buildMockFs(),
+		},
+	}
+	cfg, err := newConfigManager(ctx, &testConf{}, "unknowntest", "", false)
+
+	assert.Nil(t, err)
+
+	os.Setenv("UNKNOWNTEST_SHOULD_ENABLE_THIS", "known")
+	defer os.Unsetenv("UNKNOWNTEST_SHOULD_ENABLE_THIS")
+
+	os.Setenv("UNKNOWNTEST_SHOULD_ENABLE_THAT", "typo")
+	defer os.Unsetenv("UNKNOWNTEST_SHOULD_ENABLE_THAT")
+
+	os.Setenv("UNKNOWNTEST_EXTERNAL_ENDPOINT_PROTOCL", "typo")
+	defer os.Unsetenv("UNKNOWNTEST_EXTERNAL_ENDPOINT_PROTOCL")
+
+	unknown, err := cfg.UnknownEnvVars(&testConf{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"UNKNOWNTEST_EXTERNAL_ENDPOINT_PROTOCL",
+		"UNKNOWNTEST_SHOULD_ENABLE_THAT",
+	}, unknown)
+
+	_, err = cfg.UnknownEnvVars(testConf{})
+	assert.Equal(t, ErrConfigMustBeAPointer, err)
+}
+
+func TestConfig_load_Errors(t *testing.T) {
+	fs := buildMockFs()
+	ctx := contextStub{
+		Vals: map[interface{}]interface{}{
+			FsContextKey: fs,
+		},
+	}
+
+	cfg, err := newConfigManager(ctx, &testConf{}, "blah", configDir, false)
+
+	assert.Equal(t, ErrConfigIsDirectory{Path: configDir}, err)
+	assert.NotNil(t, cfg)
+
+	_, err = newConfigManager(ctx, &testConf{}, "blah", "/missing.yaml", true)
+
+	notFound := ErrConfigFileNotFound{}
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "/missing.yaml", notFound.Path)
+	assert.True(t, errors.Is(err, ErrConfigNotFound))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Equal(t, "config file /missing.yaml does not exist", err.Error())
+
+	_, err = newConfigManager(ctx, &testConf{}, "blah", invalidConfigPath, false)
+
+	yamlErr := ErrUnmarshallingYAML{}
+	assert.True(t, errors.As(err, &yamlErr))
+	assert.Equal(t, 8, yamlErr.Line)
+	assert.Equal(t, 0, yamlErr.Column)
+}
+
+func TestConfig_readFile_PermissionDenied(t *testing.T) {
+	c := &Config{
+		fs: permissionDeniedFs{afero.NewMemMapFs()},
+	}
+
+	_, err := c.readFile("/secret.yaml")
+
+	assert.Equal(t, ErrConfigPermissionDenied{
+		Path:    "/secret.yaml",
+		wrapped: os.ErrPermission,
+	}, err)
+	assert.True(t, errors.Is(err, os.ErrPermission))
+}
+
+func TestConfig_load_IncludesAndProfiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		"/etc/app/app.yaml": `include:
+  - fragments/endpoint.yaml
+should-enable-this: "from-base"
+`,
+		"/etc/app/fragments/endpoint.yaml": `include: common.yaml
+external-endpoint:
+  domain: from-fragment
+should-enable-this: "from-fragment"
+`,
+		"/etc/app/fragments/common.yaml": `should-do-that: "from-common"
+external-endpoint:
+  protocol: https
+`,
+		"/etc/app/app.prod.yaml": `external-endpoint:
+  domain: prod.example.com
+`,
+		"/etc/app/cycle-a.yaml":         `include: cycle-b.yaml`,
+		"/etc/app/cycle-b.yaml":         `include: [cycle-a.yaml]`,
+		"/etc/app/missing-include.yaml": `include: nope.yaml`,
+		"/etc/app/bad-include.yaml":     `include: {a: b}`,
+	}
+
+	for path, content := range files {
+		assert.Nil(t, afero.WriteFile(fs, path, []byte(content), 0644))
+	}
+
+	ctx := contextStub{
+		Vals: map[interface{}]interface{}{
+			FsContextKey: fs,
+		},
+	}
+
+	cfg := &testConf{}
+	_, err := newConfigManager(ctx, cfg, "app", "/etc/app/app.yaml", true, StrictOpt(), ValidateSchemaOpt())
+
+	assert.Nil(t, err)
+	assert.Equal(t, testConf{
+		ShouldEnableThis: "from-base",
+		ShouldDoThat:     "from-common",
+		ExternalEndpoint: testExtEndpoint{
+			Protocol: "https",
+			Domain:   "from-fragment",
+		},
+	}, *cfg)
+
+	cfg = &testConf{}
+	_, err = newConfigManager(ctx, cfg, "app", "/etc/app/app.yaml", true, ProfileOpt("prod"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "prod.example.com", cfg.ExternalEndpoint.Domain)
+	assert.Equal(t, "from-base", cfg.ShouldEnableThis)
+
+	_, err = newConfigManager(ctx, &testConf{}, "app", "/etc/app/app.yaml", true, ProfileOpt("staging"))
+	assert.Equal(t, "config file /etc/app/app.staging.yaml does not exist", err.Error())
+
+	// the profile is still applied when the optional base file is missing
+	cfg = &testConf{}
+	assert.Nil(t, afero.WriteFile(fs, "/etc/app/missing.prod.yaml", []byte("should-do-that: profile-only"), 0644))
+	_, err = newConfigManager(ctx, cfg, "app", "/etc/app/missing.yaml", false, ProfileOpt("prod"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "profile-only", cfg.ShouldDoThat)
+
+	_, err = newConfigManager(ctx, &testConf{}, "app", "/etc/app/cycle-a.yaml", true)
+	assert.Equal(t, ErrConfigIncludeCycle{
+		Chain: []string{"/etc/app/cycle-a.yaml", "/etc/app/cycle-b.yaml", "/etc/app/cycle-a.yaml"},
+	}, err)
+
+	// a missing include is an error even though the main file is optional
+	_, err = newConfigManager(ctx, &testConf{}, "app", "/etc/app/missing-include.yaml", false)
+	assert.Equal(t, "config file /etc/app/nope.yaml does not exist", err.Error())
+
+	_, err = newConfigManager(ctx, &testConf{}, "app", "/etc/app/bad-include.yaml", false)
+	assert.IsType(t, ErrUnmarshallingYAML{}, err)
+	assert.Equal(t, 1, err.(ErrUnmarshallingYAML).Line)
+}
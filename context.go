@@ -2,6 +2,8 @@ package clapp
 
 import (
 	"context"
+	"io"
+	"os"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/afero"
@@ -13,13 +15,31 @@ const FsContextKey ContextKey = "FILESYSTEM"
 const ConfigContextKey ContextKey = "APP_CONFIG"
 const ConfigManagerContextKey ContextKey = "CONFIG_MANAGER"
 const LogManagerContextKey ContextKey = "LOG_MANAGER"
+const ArgsContextKey ContextKey = "ARGS"
+const EnvironContextKey ContextKey = "ENVIRON"
+const StdoutContextKey ContextKey = "STDOUT"
+const StderrContextKey ContextKey = "STDERR"
 
 func FsFromContext(ctx context.Context) afero.Fs {
 	return ctx.Value(FsContextKey).(afero.Fs)
 }
 
+// ConfigFromContext returns the current config, this may be a different value
+// to the one given to the app if the config has since been reloaded.
 func ConfigFromContext(ctx context.Context) interface{} {
-	return ctx.Value(ConfigContextKey)
+	v := ctx.Value(ConfigContextKey)
+
+	if h, ok := v.(*configHolder); ok {
+		return h.Load()
+	}
+
+	return v
+}
+
+func ConfigManagerFromContext(ctx context.Context) *Config {
+	c, _ := ctx.Value(ConfigManagerContextKey).(*Config)
+
+	return c
 }
 
 func LogManagerFromContext(ctx context.Context) *LogManager {
@@ -30,6 +50,42 @@ func LoggerFromContext(ctx context.Context) zerolog.Logger {
 	return LogManagerFromContext(ctx).logger
 }
 
+// ArgsFromContext returns the command line arguments the app is running with,
+// or nil if they were not set, in which case executors use os.Args.
+func ArgsFromContext(ctx context.Context) []string {
+	args, _ := ctx.Value(ArgsContextKey).([]string)
+
+	return args
+}
+
+// EnvironFromContext returns the environment the app is running with, this is
+// App.Environ when it was set or a copy of the process environment.
+func EnvironFromContext(ctx context.Context) Environ {
+	if e, ok := ctx.Value(EnvironContextKey).(Environ); ok && e != nil {
+		return e
+	}
+
+	return OsEnviron()
+}
+
+// StdoutFromContext returns App.Stdout, or os.Stdout when it was not set.
+func StdoutFromContext(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(StdoutContextKey).(io.Writer); ok && w != nil {
+		return w
+	}
+
+	return os.Stdout
+}
+
+// StderrFromContext returns App.Stderr, or os.Stderr when it was not set.
+func StderrFromContext(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(StderrContextKey).(io.Writer); ok && w != nil {
+		return w
+	}
+
+	return os.Stderr
+}
+
 func contextWithFs(ctx context.Context, fs afero.Fs) context.Context {
 	if fs == nil {
 		fs = afero.NewOsFs()
@@ -46,7 +102,23 @@ func contextWithConfig(ctx context.Context, cfg interface{}) context.Context {
 	return context.WithValue(
 		ctx,
 		ConfigContextKey,
-		cfg,
+		&configHolder{
+			cfg: cfg,
+		},
+	)
+}
+
+func configHolderFromContext(ctx context.Context) *configHolder {
+	h, _ := ctx.Value(ConfigContextKey).(*configHolder)
+
+	return h
+}
+
+func contextWithConfigManager(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(
+		ctx,
+		ConfigManagerContextKey,
+		c,
 	)
 }
 
@@ -60,6 +132,22 @@ func contextWithLogger(ctx context.Context, l zerolog.Logger) context.Context {
 	)
 }
 
+func contextWithArgs(ctx context.Context, args []string) context.Context {
+	return context.WithValue(
+		ctx,
+		ArgsContextKey,
+		args,
+	)
+}
+
+func contextWithEnviron(ctx context.Context, env Environ) context.Context {
+	return context.WithValue(
+		ctx,
+		EnvironContextKey,
+		env,
+	)
+}
+
 func buildContext(ctx context.Context, fs afero.Fs, l zerolog.Logger, cfg interface{}) (c context.Context) {
 	c = contextWithFs(ctx, fs)
 	c = contextWithConfig(c, cfg)
@@ -67,3 +155,17 @@ func buildContext(ctx context.Context, fs afero.Fs, l zerolog.Logger, cfg interf
 
 	return
 }
+
+func contextWithOutput(ctx context.Context, stdout io.Writer, stderr io.Writer) context.Context {
+	ctx = context.WithValue(
+		ctx,
+		StdoutContextKey,
+		stdout,
+	)
+
+	return context.WithValue(
+		ctx,
+		StderrContextKey,
+		stderr,
+	)
+}
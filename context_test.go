@@ -3,6 +3,7 @@ package clapp
 import (
 	"bytes"
 	"context"
+	"os"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -71,3 +72,43 @@ func TestBuildContext_FsIsCreatedIfNil(t *testing.T) {
 	assert.Equal(t, l, LoggerFromContext(ctx))
 	assert.Equal(t, &cfg, ConfigFromContext(ctx))
 }
+
+func TestArgsFromContext(t *testing.T) {
+	assert.Nil(t, ArgsFromContext(context.TODO()))
+
+	ctx := contextWithArgs(context.TODO(), []string{"child", "--flag"})
+
+	assert.Equal(t, []string{"child", "--flag"}, ArgsFromContext(ctx))
+}
+
+func TestConfigFromContext_Reloaded(t *testing.T) {
+	first := &testConf{ShouldDoThat: "first"}
+	second := &testConf{ShouldDoThat: "second"}
+
+	ctx := contextWithConfig(context.TODO(), first)
+	assert.Equal(t, first, ConfigFromContext(ctx))
+
+	configHolderFromContext(ctx).Swap(second)
+	assert.Equal(t, second, ConfigFromContext(ctx))
+}
+
+func TestConfigManagerFromContext(t *testing.T) {
+	assert.Nil(t, ConfigManagerFromContext(context.TODO()))
+
+	c := &Config{}
+	ctx := contextWithConfigManager(context.TODO(), c)
+
+	assert.Equal(t, c, ConfigManagerFromContext(ctx))
+}
+
+func TestOutputFromContext(t *testing.T) {
+	assert.Equal(t, os.Stdout, StdoutFromContext(context.TODO()))
+	assert.Equal(t, os.Stderr, StderrFromContext(context.TODO()))
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	ctx := contextWithOutput(context.TODO(), stdout, stderr)
+
+	assert.Equal(t, stdout, StdoutFromContext(ctx))
+	assert.Equal(t, stderr, StderrFromContext(ctx))
+}
@@ -0,0 +1,535 @@
+package clapp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+var ErrInvalidDocFormat error = errors.New("doc format must be one of: markdown, man, json, jsonschema")
+var ErrMissingConfigSchema error = errors.New("docs have no config schema to write as jsonschema")
+
+type DocFormat string
+
+const MarkdownDocs DocFormat = "markdown"
+const ManDocs DocFormat = "man"
+const JSONDocs DocFormat = "json"
+const JSONSchemaDocs DocFormat = "jsonschema"
+
+const docsCommandName string = "gen-docs"
+
+type FlagDoc struct {
+	Name        string `json:"name"`
+	Short       string `json:"short,omitempty"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+	EnvVar      string `json:"env_var,omitempty"`
+	ConfigKey   string `json:"config_key,omitempty"`
+}
+
+type CommandDoc struct {
+	Name            string       `json:"name"`
+	Path            string       `json:"path"`
+	Short           string       `json:"short,omitempty"`
+	Long            string       `json:"long,omitempty"`
+	Aliases         []string     `json:"aliases,omitempty"`
+	Deprecated      string       `json:"deprecated,omitempty"`
+	Example         string       `json:"example,omitempty"`
+	LocalFlags      []FlagDoc    `json:"local_flags"`
+	PersistentFlags []FlagDoc    `json:"persistent_flags"`
+	InheritedFlags  []FlagDoc    `json:"inherited_flags"`
+	Children        []CommandDoc `json:"children"`
+}
+
+type ConfigKeyDoc struct {
+	Field       string `json:"field"`
+	YAMLKey     string `json:"yaml_key,omitempty"`
+	EnvVar      string `json:"env_var"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+type AppDoc struct {
+	Command CommandDoc     `json:"command"`
+	Config  []ConfigKeyDoc `json:"config"`
+
+	// Schema is published separately using the jsonschema format
+	Schema *JSONSchema `json:"-"`
+}
+
+func NewAppDoc(a App) (AppDoc, error) {
+	return newAppDoc(a, a.Config)
+}
+
+// newAppDoc documents a with the defaults of flags and config keys taken from
+// defaults, the config before any source was loaded, so the docs don't depend
+// on the env or config file of whoever generates them.
+func newAppDoc(a App, defaults interface{}) (AppDoc, error) {
+	fields, err := collectEnvConfigFields(a.Config, a.envPrefix(), a.EnvNaming)
+
+	if err != nil {
+		return AppDoc{}, err
+	}
+
+	defaultFields, err := collectEnvConfigFields(defaults, a.envPrefix(), a.EnvNaming)
+
+	if err != nil {
+		return AppDoc{}, err
+	}
+
+	schema, err := NewConfigSchema(defaults)
+
+	if err != nil {
+		return AppDoc{}, err
+	}
+
+	d := AppDoc{
+		Command: buildCommandDoc(a.RootCommand, "", nil, fields, defaultFields),
+		Config:  []ConfigKeyDoc{},
+		Schema:  schema,
+	}
+
+	for _, f := range defaultFields {
+		def := f.DefaultValue()
+
+		if f.Secret() {
+			def = maskSecret(def)
+		}
+
+		d.Config = append(d.Config, ConfigKeyDoc{
+			Field:       f.Name(),
+			YAMLKey:     f.YAMLKey(),
+			EnvVar:      f.EnvVar,
+			Type:        f.TypeName(),
+			Default:     def,
+			Required:    f.Required(),
+			Description: f.Description(),
+		})
+	}
+
+	return d, nil
+}
+
+// buildFlagDocs describes flags with their current values as the default,
+// unless defaults are given, then flags bound to the config show the value
+// from before any source was loaded.
+func buildFlagDocs(flags []Flag, fields []configField, defaults []configField) []FlagDoc {
+	docs := []FlagDoc{}
+
+	for _, f := range flags {
+		ref := f.ValueRef
+
+		if builtin, ok := builtinValue(f, fields, defaults); ok {
+			ref = builtin
+		}
+
+		fd := FlagDoc{
+			Name:        f.Name,
+			Short:       f.Short,
+			Description: f.Description,
+			Type:        string(f.Type),
+			Default:     flagDefault(ref),
+			Required:    f.Required,
+		}
+
+		cf, bound := configFieldForRef(fields, f.ValueRef)
+
+		if bound {
+			fd.EnvVar = cf.EnvVar
+			fd.ConfigKey = cf.YAMLKey()
+		}
+
+		if f.Secret || (bound && cf.Secret()) {
+			fd.Default = maskSecret(fd.Default)
+		}
+
+		docs = append(docs, fd)
+	}
+
+	return docs
+}
+
+func flagDefault(ref interface{}) string {
+	switch v := ref.(type) {
+	case *string:
+		return *v
+	case *int:
+		return fmt.Sprint(*v)
+	case *bool:
+		return fmt.Sprint(*v)
+	case *[]string:
+		return strings.Join(*v, ",")
+	case *[]int:
+		s := []string{}
+		for _, i := range *v {
+			s = append(s, fmt.Sprint(i))
+		}
+		return strings.Join(s, ",")
+	}
+
+	return ""
+}
+
+func buildCommandDoc(cmd Command, parentPath string, inherited []FlagDoc, fields []configField, defaults []configField) CommandDoc {
+	path := cmd.Name
+	if parentPath != "" {
+		path = fmt.Sprintf("%s %s", parentPath, cmd.Name)
+	}
+
+	d := CommandDoc{
+		Name:            cmd.Name,
+		Path:            path,
+		Short:           cmd.Descriptions.Short,
+		Long:            cmd.Descriptions.Long,
+		Aliases:         cmd.Aliases,
+		Deprecated:      cmd.Deprecated,
+		Example:         cmd.Example,
+		LocalFlags:      buildFlagDocs(cmd.LocalFlags, fields, defaults),
+		PersistentFlags: buildFlagDocs(cmd.PersistentFlags, fields, defaults),
+		InheritedFlags:  append([]FlagDoc{}, inherited...),
+		Children:        []CommandDoc{},
+	}
+
+	childInherited := append(append([]FlagDoc{}, inherited...), d.PersistentFlags...)
+
+	for _, c := range cmd.Children {
+		if c.Hidden {
+			continue
+		}
+
+		d.Children = append(d.Children, buildCommandDoc(c, path, childInherited, fields, defaults))
+	}
+
+	return d
+}
+
+func (d AppDoc) commands() []CommandDoc {
+	all := []CommandDoc{}
+
+	var visit func(c CommandDoc)
+	visit = func(c CommandDoc) {
+		all = append(all, c)
+
+		for _, ch := range c.Children {
+			visit(ch)
+		}
+	}
+	visit(d.Command)
+
+	return all
+}
+
+func (d AppDoc) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(d)
+}
+
+// markdownCell escapes s so it stays in one cell of a table.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func writeMarkdownFlags(w io.Writer, title string, flags []FlagDoc) {
+	if len(flags) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "### %s\n\n", title)
+	fmt.Fprintln(w, "| Flag | Type | Default | Required | Env | Description |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- |")
+
+	for _, f := range flags {
+		name := fmt.Sprintf("`--%s`", f.Name)
+		if f.Short != "" {
+			name = fmt.Sprintf("`-%s`, %s", f.Short, name)
+		}
+
+		env := ""
+		if f.EnvVar != "" {
+			env = fmt.Sprintf("`%s`", f.EnvVar)
+		}
+
+		fmt.Fprintf(w, "| %s | %s | %s | %t | %s | %s |\n", name, f.Type, markdownCell(f.Default), f.Required, env, markdownCell(f.Description))
+	}
+
+	fmt.Fprintln(w)
+}
+
+// WriteMarkdown writes the page for a single command, the configuration
+// section is only included on the root command's page.
+func (d AppDoc) WriteMarkdown(w io.Writer, c CommandDoc) error {
+	fmt.Fprintf(w, "## %s\n\n", c.Path)
+
+	if c.Short != "" {
+		fmt.Fprintf(w, "%s\n\n", c.Short)
+	}
+
+	if c.Deprecated != "" {
+		fmt.Fprintf(w, "**Deprecated:** %s\n\n", c.Deprecated)
+	}
+
+	if c.Long != "" {
+		fmt.Fprintf(w, "### Synopsis\n\n%s\n\n", strings.TrimSpace(c.Long))
+	}
+
+	fmt.Fprintf(w, "```\n%s [flags]\n```\n\n", c.Path)
+
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(w, "Aliases: `%s`\n\n", strings.Join(c.Aliases, "`, `"))
+	}
+
+	if c.Example != "" {
+		fmt.Fprintf(w, "### Examples\n\n```\n%s\n```\n\n", strings.TrimRight(c.Example, "\n"))
+	}
+
+	writeMarkdownFlags(w, "Options", append(append([]FlagDoc{}, c.LocalFlags...), c.PersistentFlags...))
+	writeMarkdownFlags(w, "Options inherited from parent commands", c.InheritedFlags)
+
+	if c.Path == d.Command.Path && len(d.Config) > 0 {
+		fmt.Fprintln(w, "### Configuration")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| YAML key | Env | Type | Default | Required | Description |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- |")
+
+		for _, k := range d.Config {
+			yamlKey := ""
+			if k.YAMLKey != "" {
+				yamlKey = fmt.Sprintf("`%s`", k.YAMLKey)
+			}
+
+			fmt.Fprintf(w, "| %s | `%s` | %s | %s | %t | %s |\n", yamlKey, k.EnvVar, k.Type, markdownCell(k.Default), k.Required, markdownCell(k.Description))
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	if len(c.Children) > 0 {
+		fmt.Fprintln(w, "### Subcommands")
+		fmt.Fprintln(w)
+
+		for _, ch := range c.Children {
+			fmt.Fprintf(w, "* [%s](%s.md) - %s\n", ch.Path, docFileName(ch.Path, "_"), ch.Short)
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+func manEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = `\&` + l
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func writeManFlags(w io.Writer, title string, flags []FlagDoc) {
+	if len(flags) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, ".SH %s\n", title)
+
+	for _, f := range flags {
+		fmt.Fprintln(w, ".TP")
+
+		name := fmt.Sprintf(`\fB\-\-%s\fP`, manEscape(f.Name))
+		if f.Short != "" {
+			name = fmt.Sprintf(`\fB\-%s\fP, %s`, manEscape(f.Short), name)
+		}
+
+		if f.Default != "" {
+			name = fmt.Sprintf("%s=%s", name, manEscape(f.Default))
+		}
+
+		fmt.Fprintln(w, name)
+		fmt.Fprintln(w, manEscape(f.Description))
+	}
+}
+
+// WriteMan writes a section 1 man page for a single command, the environment
+// section is only included on the root command's page.
+func (d AppDoc) WriteMan(w io.Writer, c CommandDoc) error {
+	title := strings.ToUpper(docFileName(c.Path, "-"))
+
+	fmt.Fprintf(w, ".TH \"%s\" \"1\" \"\" \"%s\" \"\"\n", manEscape(title), manEscape(d.Command.Name))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintf(w, "%s \\- %s\n", manEscape(docFileName(c.Path, "-")), manEscape(c.Short))
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintf(w, "\\fB%s\\fP [flags]\n", manEscape(c.Path))
+
+	desc := strings.TrimSpace(c.Long)
+
+	if c.Deprecated != "" {
+		desc = strings.TrimSpace(fmt.Sprintf("Deprecated: %s\n%s", c.Deprecated, desc))
+	}
+
+	if desc != "" {
+		fmt.Fprintln(w, ".SH DESCRIPTION")
+		fmt.Fprintln(w, manEscape(desc))
+	}
+
+	if c.Example != "" {
+		fmt.Fprintln(w, ".SH EXAMPLES")
+		fmt.Fprintln(w, ".nf")
+		fmt.Fprintln(w, manEscape(strings.TrimRight(c.Example, "\n")))
+		fmt.Fprintln(w, ".fi")
+	}
+
+	writeManFlags(w, "OPTIONS", append(append([]FlagDoc{}, c.LocalFlags...), c.PersistentFlags...))
+	writeManFlags(w, "OPTIONS INHERITED FROM PARENT COMMANDS", c.InheritedFlags)
+
+	if c.Path == d.Command.Path && len(d.Config) > 0 {
+		fmt.Fprintln(w, ".SH ENVIRONMENT")
+
+		for _, k := range d.Config {
+			fmt.Fprintln(w, ".TP")
+			fmt.Fprintf(w, "\\fB%s\\fP (%s)\n", manEscape(k.EnvVar), manEscape(k.Type))
+
+			desc := k.Description
+			if k.YAMLKey != "" {
+				desc = strings.TrimSpace(fmt.Sprintf("%s Config file key: %s.", desc, k.YAMLKey))
+			}
+
+			fmt.Fprintln(w, manEscape(desc))
+		}
+	}
+
+	if len(c.Children) > 0 {
+		fmt.Fprintln(w, ".SH SEE ALSO")
+
+		refs := []string{}
+		for _, ch := range c.Children {
+			refs = append(refs, fmt.Sprintf("\\fB%s\\fP(1)", manEscape(docFileName(ch.Path, "-"))))
+		}
+
+		fmt.Fprintln(w, strings.Join(refs, ", "))
+	}
+
+	return nil
+}
+
+func docFileName(path string, sep string) string {
+	return strings.Join(strings.Fields(path), sep)
+}
+
+// WriteDocs writes the documentation for the whole command tree into dir.
+// Markdown and man formats produce a file per command, json produces a single
+// file describing the entire app and jsonschema produces the config schema.
+func (d AppDoc) WriteDocs(fs afero.Fs, dir string, format DocFormat) error {
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	writeFile := func(name string, write func(w io.Writer) error) error {
+		f, err := fs.Create(filepath.Join(dir, name))
+
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return write(f)
+	}
+
+	switch format {
+	case JSONDocs:
+		return writeFile(fmt.Sprintf("%s.json", d.Command.Name), d.WriteJSON)
+	case JSONSchemaDocs:
+		if d.Schema == nil {
+			return ErrMissingConfigSchema
+		}
+
+		return writeFile(fmt.Sprintf("%s.schema.json", d.Command.Name), d.Schema.WriteJSON)
+	case MarkdownDocs:
+		for _, c := range d.commands() {
+			c := c
+			err := writeFile(fmt.Sprintf("%s.md", docFileName(c.Path, "_")), func(w io.Writer) error {
+				return d.WriteMarkdown(w, c)
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case ManDocs:
+		for _, c := range d.commands() {
+			c := c
+			err := writeFile(fmt.Sprintf("%s.1", docFileName(c.Path, "-")), func(w io.Writer) error {
+				return d.WriteMan(w, c)
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return ErrInvalidDocFormat
+}
+
+// docsCommand documents root, the root command with the built in flags and
+// commands added, rather than a.RootCommand.
+func docsCommand(a App, root Command) Command {
+	a.RootCommand = root
+
+	format := string(MarkdownDocs)
+	dir := "./docs"
+
+	return Command{
+		Name: docsCommandName,
+		Descriptions: Descriptions{
+			Short: "Generate documentation for this application",
+		},
+		LocalFlags: []Flag{
+			{
+				Name:        "format",
+				Short:       "f",
+				Description: "The format to generate docs in (markdown, man, json, jsonschema)",
+				ValueRef:    &format,
+				Type:        StringFlag,
+			},
+			{
+				Name:        "dir",
+				Short:       "d",
+				Description: "The directory to write the docs into",
+				ValueRef:    &dir,
+				Type:        StringFlag,
+			},
+		},
+		Handle: func(cmd *cobra.Command, args []string) error {
+			d, err := newAppDoc(a, ConfigManagerFromContext(cmd.Context()).builtinDefaults())
+
+			if err != nil {
+				return err
+			}
+
+			return d.WriteDocs(FsFromContext(cmd.Context()), dir, DocFormat(format))
+		},
+		Hidden: true,
+	}
+}
@@ -0,0 +1,352 @@
+package clapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildDocsTestApp() App {
+	cfg := &testConf{
+		ShouldDoThat: "default-that",
+	}
+	other := 3
+
+	return App{
+		Config: cfg,
+		RootCommand: Command{
+			Name: "blah",
+			Descriptions: Descriptions{
+				Short: "the root",
+				Long:  "the root command does things",
+			},
+			PersistentFlags: []Flag{
+				{
+					Name:        "should-do-that",
+					Short:       "s",
+					Description: "what should be done",
+					ValueRef:    &cfg.ShouldDoThat,
+					Type:        StringFlag,
+				},
+			},
+			Children: []Command{
+				{
+					Name:       "child",
+					Aliases:    []string{"kid"},
+					Deprecated: "use other",
+					Example:    "  blah child --other 1",
+					Descriptions: Descriptions{
+						Short: "the child",
+					},
+					LocalFlags: []Flag{
+						{
+							Name:        "other",
+							Description: "not in config",
+							ValueRef:    &other,
+							Type:        IntFlag,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:   "secret",
+					Hidden: true,
+				},
+			},
+		},
+	}
+}
+
+func TestNewAppDoc(t *testing.T) {
+	d, err := NewAppDoc(buildDocsTestApp())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "blah", d.Command.Path)
+	assert.Equal(t, []FlagDoc{
+		{
+			Name:        "should-do-that",
+			Short:       "s",
+			Description: "what should be done",
+			Type:        "string",
+			Default:     "default-that",
+			EnvVar:      "BLAH_SHOULD_DO_THAT",
+			ConfigKey:   "should-do-that",
+		},
+	}, d.Command.PersistentFlags)
+
+	assert.Len(t, d.Command.Children, 1)
+	child := d.Command.Children[0]
+	assert.Equal(t, "blah child", child.Path)
+	assert.Equal(t, []string{"kid"}, child.Aliases)
+	assert.Equal(t, "use other", child.Deprecated)
+	assert.Equal(t, "  blah child --other 1", child.Example)
+	assert.Equal(t, d.Command.PersistentFlags, child.InheritedFlags)
+	assert.Equal(t, []FlagDoc{
+		{
+			Name:        "other",
+			Description: "not in config",
+			Type:        "int",
+			Default:     "3",
+			Required:    true,
+		},
+	}, child.LocalFlags)
+
+	assert.Len(t, d.Config, 6)
+	assert.Equal(t, ConfigKeyDoc{
+		Field:   "ShouldDoThat",
+		YAMLKey: "should-do-that",
+		EnvVar:  "BLAH_SHOULD_DO_THAT",
+		Type:    "string",
+		Default: "default-that",
+	}, d.Config[1])
+}
+
+func TestNewAppDoc_FailsForNonPointerConfig(t *testing.T) {
+	_, err := NewAppDoc(App{Config: testConf{}})
+
+	assert.Equal(t, ErrConfigMustBeAPointer, err)
+}
+
+func TestAppDoc_WriteJSON(t *testing.T) {
+	d, err := NewAppDoc(buildDocsTestApp())
+	assert.Nil(t, err)
+
+	b := new(bytes.Buffer)
+	assert.Nil(t, d.WriteJSON(b))
+
+	decoded := AppDoc{}
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, d.Command, decoded.Command)
+	assert.Equal(t, d.Config, decoded.Config)
+	assert.Nil(t, decoded.Schema)
+}
+
+func TestAppDoc_WriteMarkdown(t *testing.T) {
+	d, err := NewAppDoc(buildDocsTestApp())
+	assert.Nil(t, err)
+
+	b := new(bytes.Buffer)
+	assert.Nil(t, d.WriteMarkdown(b, d.Command))
+
+	out := b.String()
+	assert.Contains(t, out, "## blah\n")
+	assert.Contains(t, out, "| `-s`, `--should-do-that` | string | default-that | false | `BLAH_SHOULD_DO_THAT` | what should be done |")
+	assert.Contains(t, out, "| `external-endpoint.port` | `BLAH_EXTERNAL_ENDPOINT_PORT` | int |")
+	assert.Contains(t, out, "* [blah child](blah_child.md) - the child")
+
+	b = new(bytes.Buffer)
+	assert.Nil(t, d.WriteMarkdown(b, d.Command.Children[0]))
+
+	out = b.String()
+	assert.Contains(t, out, "**Deprecated:** use other\n")
+	assert.Contains(t, out, "Aliases: `kid`\n")
+	assert.Contains(t, out, "### Examples\n\n```\n  blah child --other 1\n```\n")
+}
+
+func TestAppDoc_WriteMarkdown_EscapesPipes(t *testing.T) {
+	a := buildDocsTestApp()
+	a.RootCommand.PersistentFlags[0].Description = "this | that"
+	a.Config.(*testConf).ShouldDoThat = "a|b"
+
+	d, err := NewAppDoc(a)
+	assert.Nil(t, err)
+
+	b := new(bytes.Buffer)
+	assert.Nil(t, d.WriteMarkdown(b, d.Command))
+
+	assert.Contains(t, b.String(), "| string | a\\|b | false | `BLAH_SHOULD_DO_THAT` | this \\| that |")
+}
+
+func TestAppDoc_WriteMan(t *testing.T) {
+	d, err := NewAppDoc(buildDocsTestApp())
+	assert.Nil(t, err)
+
+	b := new(bytes.Buffer)
+	assert.Nil(t, d.WriteMan(b, d.Command.Children[0]))
+
+	out := b.String()
+	assert.Contains(t, out, ".TH \"BLAH\\-CHILD\" \"1\"")
+	assert.Contains(t, out, "blah\\-child \\- the child")
+	assert.Contains(t, out, ".SH OPTIONS INHERITED FROM PARENT COMMANDS")
+	assert.NotContains(t, out, ".SH ENVIRONMENT")
+	assert.Contains(t, out, ".SH DESCRIPTION\nDeprecated: use other\n")
+	assert.Contains(t, out, ".SH EXAMPLES\n.nf\n  blah child \\-\\-other 1\n.fi\n")
+}
+
+func TestAppDoc_WriteDocs(t *testing.T) {
+	d, err := NewAppDoc(buildDocsTestApp())
+	assert.Nil(t, err)
+
+	tests := []struct {
+		format        DocFormat
+		expectedFiles []string
+		expectedErr   error
+	}{
+		{
+			format:        MarkdownDocs,
+			expectedFiles: []string{"/docs/blah.md", "/docs/blah_child.md"},
+		},
+		{
+			format:        ManDocs,
+			expectedFiles: []string{"/docs/blah.1", "/docs/blah-child.1"},
+		},
+		{
+			format:        JSONDocs,
+			expectedFiles: []string{"/docs/blah.json"},
+		},
+		{
+			format:        JSONSchemaDocs,
+			expectedFiles: []string{"/docs/blah.schema.json"},
+		},
+		{
+			format:      DocFormat("pdf"),
+			expectedErr: ErrInvalidDocFormat,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(tt *testing.T) {
+			fs := afero.NewMemMapFs()
+
+			assert.Equal(tt, test.expectedErr, d.WriteDocs(fs, "/docs", test.format))
+
+			for _, f := range test.expectedFiles {
+				exists, _ := afero.Exists(fs, f)
+				assert.True(tt, exists, "expected %s to exist", f)
+			}
+		})
+	}
+}
+
+func TestAppDoc_WriteDocs_FailsWithoutSchema(t *testing.T) {
+	d := AppDoc{
+		Command: CommandDoc{
+			Name: "blah",
+		},
+	}
+
+	assert.Equal(t, ErrMissingConfigSchema, d.WriteDocs(afero.NewMemMapFs(), "/docs", JSONSchemaDocs))
+}
+
+func TestNewAppDoc_MasksSecrets(t *testing.T) {
+	cfg := &testSecretConf{
+		Password: "hunter2",
+	}
+	apiKey := "letmein"
+
+	d, err := NewAppDoc(App{
+		Config: cfg,
+		RootCommand: Command{
+			Name: "secretive",
+			LocalFlags: []Flag{
+				{
+					Name:     "password",
+					ValueRef: &cfg.Password,
+					Type:     StringFlag,
+				},
+				{
+					Name:     "api-key",
+					ValueRef: &apiKey,
+					Type:     StringFlag,
+					Secret:   true,
+				},
+			},
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, SecretMask, d.Command.LocalFlags[0].Default)
+	assert.Equal(t, SecretMask, d.Command.LocalFlags[1].Default)
+	assert.Equal(t, SecretMask, d.Config[1].Default)
+}
+
+func TestRun_DocsUseBuiltinDefaults(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/blah.yaml", []byte("should-do-that: from-file\n"), 0644))
+
+	a := buildDocsTestApp()
+	a.Fs = fs
+	a.ConfigPath = "/blah.yaml"
+	a.DocsCommand = true
+	a.Args = []string{"gen-docs", "--format", "json", "--dir", "/docs"}
+	a.Environ = Environ{"BLAH_LIST_OF_THINGS": "from,env"}
+	a.Stdout = &bytes.Buffer{}
+	a.Stderr = &bytes.Buffer{}
+
+	assert.Nil(t, Run(a, NewCobraExecutor()))
+
+	out, err := afero.ReadFile(fs, "/docs/blah.json")
+	assert.Nil(t, err)
+
+	d := AppDoc{}
+	assert.Nil(t, json.Unmarshal(out, &d))
+
+	assert.Equal(t, "default-that", d.Command.PersistentFlags[0].Default)
+
+	for _, k := range d.Config {
+		assert.NotContains(t, k.Default, "from")
+	}
+}
+
+func TestRun_DocsIncludeBuiltinFlags(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	a := buildDocsTestApp()
+	a.Fs = fs
+	a.DocsCommand = true
+	a.VersionCommand = true
+	a.OutputFlag = true
+	a.Args = []string{"gen-docs", "--format", "json", "--dir", "/docs"}
+	a.Environ = Environ{}
+	a.Stdout = &bytes.Buffer{}
+	a.Stderr = &bytes.Buffer{}
+
+	assert.Nil(t, Run(a, NewCobraExecutor()))
+
+	out, err := afero.ReadFile(fs, "/docs/blah.json")
+	assert.Nil(t, err)
+
+	d := AppDoc{}
+	assert.Nil(t, json.Unmarshal(out, &d))
+
+	flags := []string{}
+	for _, f := range d.Command.PersistentFlags {
+		flags = append(flags, f.Name)
+	}
+
+	children := []string{}
+	for _, c := range d.Command.Children {
+		children = append(children, c.Name)
+	}
+
+	assert.Subset(t, flags, []string{"config", "profile", "version", "output"})
+	assert.Contains(t, children, "version")
+}
+
+func TestRun_DocsSchemaUsesBuiltinDefaults(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/blah.yaml", []byte("should-do-that: from-file\n"), 0644))
+
+	a := buildDocsTestApp()
+	a.Fs = fs
+	a.ConfigPath = "/blah.yaml"
+	a.DocsCommand = true
+	a.Args = []string{"gen-docs", "--format", "jsonschema", "--dir", "/docs"}
+	a.Environ = Environ{"BLAH_SHOULD_ENABLE_THIS": "from-env"}
+	a.Stdout = &bytes.Buffer{}
+	a.Stderr = &bytes.Buffer{}
+
+	assert.Nil(t, Run(a, NewCobraExecutor()))
+
+	out, err := afero.ReadFile(fs, "/docs/blah.schema.json")
+	assert.Nil(t, err)
+
+	s := JSONSchema{}
+	assert.Nil(t, json.Unmarshal(out, &s))
+
+	assert.Equal(t, "default-that", s.Properties["should-do-that"].Default)
+	assert.Nil(t, s.Properties["should-enable-this"].Default)
+}
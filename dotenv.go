@@ -0,0 +1,323 @@
+package clapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const defaultDotEnvPath string = ".env"
+
+// DotEnvSource reads variables from a .env file, followed by .env.<profile>
+// when a profile is selected, and makes them visible to EnvSource. Variables
+// set in the real environment take precedence and the process environment is
+// never modified. It must come before EnvSource in the pipeline.
+type DotEnvSource struct {
+	// Path defaults to .env
+	Path      string
+	MustExist bool
+}
+
+func (s DotEnvSource) Name() string {
+	return fmt.Sprintf("dotenv:%s", s.path())
+}
+
+func (s DotEnvSource) path() string {
+	if s.Path == "" {
+		return defaultDotEnvPath
+	}
+
+	return s.Path
+}
+
+func (s DotEnvSource) Load(ctx context.Context, into interface{}) error {
+	c := ConfigManagerFromContext(ctx)
+	paths := []string{s.path()}
+
+	if c.profile != "" {
+		paths = append(paths, fmt.Sprintf("%s.%s", s.path(), c.profile))
+	}
+
+	for i, path := range paths {
+		c.trackFile(path)
+
+		b, err := readConfigFile(FsFromContext(ctx), path)
+
+		if _, notFound := err.(ErrConfigFileNotFound); notFound && (i > 0 || !s.MustExist) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		vars, err := parseDotEnv(string(b), c.getenv)
+
+		if err != nil {
+			var parseErr ErrParsingDotEnv
+			if errors.As(err, &parseErr) {
+				parseErr.Path = path
+				return parseErr
+			}
+
+			return err
+		}
+
+		if c.dotEnv == nil {
+			c.dotEnv = map[string]string{}
+		}
+
+		for k, v := range vars {
+			c.dotEnv[k] = v
+		}
+	}
+
+	return nil
+}
+
+func isDotEnvKeyChar(b byte, first bool) bool {
+	switch {
+	case b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z'):
+		return true
+	case b == '.' || (b >= '0' && b <= '9'):
+		return !first
+	}
+
+	return false
+}
+
+// parseDotEnv parses the contents of a .env file. Values may be unquoted,
+// 'single quoted' (taken literally) or "double quoted" (escapes are handled),
+// and the quoted forms may span several lines. ${VAR}, ${VAR:-default} and
+// $VAR are interpolated in all but single quoted values, looking first in
+// lookup and then at the variables defined earlier in the file.
+func parseDotEnv(src string, lookup func(string) (string, bool)) (map[string]string, error) {
+	vars := map[string]string{}
+	resolve := func(name string) (string, bool) {
+		if v, ok := lookup(name); ok {
+			return v, true
+		}
+
+		v, ok := vars[name]
+
+		return v, ok
+	}
+
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	line := 1
+
+	for len(src) > 0 {
+		var current string
+		current, src = cutLine(src)
+		start := line
+		line++
+
+		trimmed := strings.TrimSpace(current)
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if rest := strings.TrimPrefix(trimmed, "export"); rest != trimmed && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			trimmed = strings.TrimLeft(rest, " \t")
+		}
+		eq := strings.IndexByte(trimmed, '=')
+
+		if eq == -1 {
+			return nil, ErrParsingDotEnv{
+				Line:    start,
+				wrapped: fmt.Errorf("expected KEY=VALUE"),
+			}
+		}
+
+		key := strings.TrimSpace(trimmed[:eq])
+
+		for i := 0; i < len(key); i++ {
+			if !isDotEnvKeyChar(key[i], i == 0) {
+				return nil, ErrParsingDotEnv{
+					Line:    start,
+					wrapped: fmt.Errorf("invalid variable name %q", key),
+				}
+			}
+		}
+
+		if key == "" {
+			return nil, ErrParsingDotEnv{
+				Line:    start,
+				wrapped: fmt.Errorf("missing variable name"),
+			}
+		}
+
+		raw := strings.TrimLeft(trimmed[eq+1:], " \t")
+
+		if raw == "" || (raw[0] != '"' && raw[0] != '\'') {
+			// an unquoted value ends at a comment
+			if idx := strings.Index(raw, " #"); idx != -1 {
+				raw = raw[:idx]
+			}
+
+			v, err := interpolateDotEnv(strings.TrimSpace(raw), resolve)
+
+			if err != nil {
+				return nil, ErrParsingDotEnv{
+					Line:    start,
+					wrapped: err,
+				}
+			}
+
+			vars[key] = v
+			continue
+		}
+
+		quote := raw[0]
+		raw = raw[1:]
+
+		// keep reading lines until the closing quote is found
+		end := closingQuote(raw, quote)
+		for end == -1 && len(src) > 0 {
+			var next string
+			next, src = cutLine(src)
+			line++
+			raw = raw + "\n" + next
+			end = closingQuote(raw, quote)
+		}
+
+		if end == -1 {
+			return nil, ErrParsingDotEnv{
+				Line:    start,
+				wrapped: fmt.Errorf("unterminated quoted value"),
+			}
+		}
+
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, ErrParsingDotEnv{
+				Line:    start,
+				wrapped: fmt.Errorf("unexpected characters after quoted value"),
+			}
+		}
+
+		raw = raw[:end]
+
+		if quote == '\'' {
+			vars[key] = raw
+			continue
+		}
+
+		v, err := interpolateDotEnv(unescapeDotEnv(raw), resolve)
+
+		if err != nil {
+			return nil, ErrParsingDotEnv{
+				Line:    start,
+				wrapped: err,
+			}
+		}
+
+		vars[key] = v
+	}
+
+	return vars, nil
+}
+
+func cutLine(s string) (string, string) {
+	if idx := strings.IndexByte(s, '\n'); idx != -1 {
+		return s[:idx], s[idx+1:]
+	}
+
+	return s, ""
+}
+
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && quote == '"' {
+			i++
+			continue
+		}
+
+		if s[i] == quote {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unescapeDotEnv handles the escapes allowed in double quoted values, an
+// escaped $ is left as $$ so it survives interpolation as a literal $.
+func unescapeDotEnv(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// interpolateDotEnv works like expandEnv but also allows $VAR, and variables
+// that are not set are replaced with an empty string as shells do. Invalid
+// expressions such as ${1X} and a ${ without its closing brace are errors.
+func interpolateDotEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i:], '}')
+
+			if end == -1 {
+				return "", fmt.Errorf("missing closing brace in %s", s[i:])
+			}
+
+			expr := s[i+2 : i+end]
+			v, err := expandExpr(expr, lookup)
+
+			// an unset variable is left empty, anything else is invalid
+			if err != nil && envNameRegexp.FindString(expr) != expr {
+				return "", fmt.Errorf("invalid expression ${%s}", expr)
+			}
+
+			b.WriteString(v)
+			i += end
+		case isDotEnvKeyChar(next, true):
+			end := i + 1
+			for end < len(s) && isDotEnvKeyChar(s[end], false) && s[end] != '.' {
+				end++
+			}
+
+			v, _ := lookup(s[i+1 : end])
+			b.WriteString(v)
+			i = end - 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
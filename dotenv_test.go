@@ -0,0 +1,251 @@
+package clapp
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		expected     map[string]string
+		expectedLine int
+	}{
+		{
+			name: "plain values and comments",
+			src: `# a comment
+FOO=bar
+  SPACED = value with spaces   # trailing comment
+EMPTY=
+HASH=abc#def
+`,
+			expected: map[string]string{
+				"FOO":    "bar",
+				"SPACED": "value with spaces",
+				"EMPTY":  "",
+				"HASH":   "abc#def",
+			},
+		},
+		{
+			name: "export prefix",
+			src:  "export FOO=bar\r\nexport BAR='baz'\r\nexport\tTABBED=qux\nexported=yes\n",
+			expected: map[string]string{
+				"FOO":      "bar",
+				"BAR":      "baz",
+				"TABBED":   "qux",
+				"exported": "yes",
+			},
+		},
+		{
+			name: "quoting",
+			src: `SINGLE='${FOO} \n stays'
+DOUBLE="line\none \"quoted\" \$FOO"
+MULTI="first
+second"
+AFTER="value" # comment
+`,
+			expected: map[string]string{
+				"SINGLE": `${FOO} \n stays`,
+				"DOUBLE": "line\none \"quoted\" $FOO",
+				"MULTI":  "first\nsecond",
+				"AFTER":  "value",
+			},
+		},
+		{
+			name: "interpolation",
+			src: `HOST=localhost
+URL=http://${HOST}:$PORT/
+FROM_ENV=${DOTENV_TEST_REAL}
+DEFAULTED=${MISSING:-fallback}
+UNSET=[$MISSING]
+UNSET_BRACED=[${MISSING}]
+DOLLAR=$$HOST
+`,
+			expected: map[string]string{
+				"HOST":         "localhost",
+				"URL":          "http://localhost:8080/",
+				"FROM_ENV":     "real",
+				"DEFAULTED":    "fallback",
+				"UNSET":        "[]",
+				"UNSET_BRACED": "[]",
+				"DOLLAR":       "$HOST",
+			},
+		},
+		{
+			name:         "missing equals",
+			src:          "FOO=bar\nNOPE\n",
+			expectedLine: 2,
+		},
+		{
+			name:         "invalid name",
+			src:          "1FOO=bar\n",
+			expectedLine: 1,
+		},
+		{
+			name:         "unterminated quote",
+			src:          "FOO=bar\nBAR=\"baz\nqux\n",
+			expectedLine: 2,
+		},
+		{
+			name:         "invalid interpolation",
+			src:          "FOO=bar\nBAR=${1X}\n",
+			expectedLine: 2,
+		},
+		{
+			name:         "invalid interpolation in double quotes",
+			src:          "FOO=\"${FOO BAR}\"\n",
+			expectedLine: 1,
+		},
+		{
+			name:         "unterminated interpolation",
+			src:          "FOO=bar\n\nBAR=${FOO\n",
+			expectedLine: 3,
+		},
+		{
+			name:         "junk after quote",
+			src:          "FOO='bar' baz\n",
+			expectedLine: 1,
+		},
+	}
+
+	lookup := mapLookup(map[string]string{
+		"PORT":             "8080",
+		"DOTENV_TEST_REAL": "real",
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			vars, err := parseDotEnv(test.src, lookup)
+
+			if test.expectedLine != 0 {
+				assert.IsType(tt, ErrParsingDotEnv{}, err)
+				assert.Equal(tt, test.expectedLine, err.(ErrParsingDotEnv).Line)
+				return
+			}
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, vars)
+		})
+	}
+}
+
+func TestRun_DotEnvSource(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, ".env", []byte(`DOTENV_SHOULD_ENABLE_THIS=from-dotenv
+DOTENV_SHOULD_DO_THAT=from-dotenv
+export DOTENV_EXTERNAL_ENDPOINT_DOMAIN=${DOTENV_SHOULD_DO_THAT}.example.com
+`), 0644))
+	assert.Nil(t, afero.WriteFile(fs, ".env.prod", []byte(`DOTENV_EXTERNAL_ENDPOINT_PORT=443
+`), 0644))
+	// the profile also selects an overlay for the yaml config
+	assert.Nil(t, afero.WriteFile(fs, "/app.prod.yaml", []byte(""), 0644))
+
+	os.Setenv("DOTENV_SHOULD_DO_THAT", "from-env")
+	defer os.Unsetenv("DOTENV_SHOULD_DO_THAT")
+
+	cfg := &testConf{}
+	err := Run(App{
+		Config:     cfg,
+		ConfigPath: "/app.yaml",
+		Fs:         fs,
+		Args:       []string{"--profile", "prod"},
+		Sources: []Source{
+			FileSource(),
+			DotEnvSource{},
+			EnvSource(),
+		},
+		RootCommand: Command{
+			Name: "dotenv",
+		},
+	}, &DummyExecutor{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, &testConf{
+		ShouldEnableThis: "from-dotenv",
+		// the real environment wins
+		ShouldDoThat: "from-env",
+		ExternalEndpoint: testExtEndpoint{
+			Domain: "from-env.example.com",
+			Port:   443,
+		},
+	}, cfg)
+
+	_, set := os.LookupEnv("DOTENV_SHOULD_ENABLE_THIS")
+	assert.False(t, set)
+}
+
+func TestRun_DotEnvSourceErrors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/bad.env", []byte("FOO=bar\nBAD\n"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/interpolate.env", []byte("FOO=bar\nBAR=${1X}\n"), 0644))
+
+	err := Run(App{
+		Config:  &testConf{},
+		Fs:      fs,
+		Args:    []string{},
+		Sources: []Source{DotEnvSource{Path: "/bad.env"}},
+		RootCommand: Command{
+			Name: "dotenv",
+		},
+	}, &DummyExecutor{})
+
+	assert.Equal(t, ErrParsingDotEnv{
+		Path:    "/bad.env",
+		Line:    2,
+		wrapped: err.(ErrParsingDotEnv).wrapped,
+	}, err)
+
+	err = Run(App{
+		Config:  &testConf{},
+		Fs:      fs,
+		Args:    []string{},
+		Sources: []Source{DotEnvSource{Path: "/interpolate.env"}},
+		RootCommand: Command{
+			Name: "dotenv",
+		},
+	}, &DummyExecutor{})
+
+	assert.EqualError(t, err, `failed to parse /interpolate.env on line 2: invalid expression ${1X}`)
+
+	err = Run(App{
+		Config:  &testConf{},
+		Fs:      fs,
+		Args:    []string{},
+		Sources: []Source{DotEnvSource{Path: "/missing.env", MustExist: true}},
+		RootCommand: Command{
+			Name: "dotenv",
+		},
+	}, &DummyExecutor{})
+
+	assert.IsType(t, ErrConfigFileNotFound{}, err)
+}
+
+func TestRun_DotEnvSourceUnknownEnvVars(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, ".env", []byte(`DOTENV_SHOULD_DO_THAT=from-dotenv
+DOTENV_SHOULD_DO_THIS=typo
+`), 0644))
+
+	err := Run(App{
+		Config:         &testConf{},
+		Fs:             fs,
+		Args:           []string{},
+		Environ:        Environ{"DOTENV_UNKNOWN": "from-env"},
+		UnknownEnvVars: ErrorOnUnknownEnvVars,
+		Sources: []Source{
+			DotEnvSource{},
+			EnvSource(),
+		},
+		RootCommand: Command{
+			Name: "dotenv",
+		},
+	}, &DummyExecutor{})
+
+	assert.Equal(t, ErrUnknownEnvVars{
+		Names: []string{"DOTENV_SHOULD_DO_THIS", "DOTENV_UNKNOWN"},
+	}, err)
+}
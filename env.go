@@ -0,0 +1,230 @@
+package clapp
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// processEnv populates cfg from environment variables using the same naming,
+// default and required rules as envconfig.Process, but reading variables
+// through lookup rather than from the process environment.
+func processEnv(prefix string, naming EnvNaming, cfg interface{}, lookup func(string) (string, bool)) error {
+	rval := reflect.ValueOf(cfg)
+
+	if rval.Kind() != reflect.Ptr || rval.Elem().Kind() != reflect.Struct {
+		return envconfig.ErrInvalidSpecification
+	}
+
+	allocStructPtrs(rval.Elem())
+
+	fields, err := collectEnvConfigFields(cfg, prefix, naming)
+
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		value, ok := lookup(f.EnvVar)
+
+		if !ok && f.EnvAlt != "" {
+			value, ok = lookup(f.EnvAlt)
+		}
+
+		def := f.Tag.Get("default")
+		if def != "" && !ok {
+			value = def
+		}
+
+		if !ok && def == "" {
+			if f.Required() {
+				key := f.EnvVar
+				if f.EnvAlt != "" {
+					key = f.EnvAlt
+				}
+
+				return fmt.Errorf("required key %s missing value", key)
+			}
+
+			continue
+		}
+
+		if err := setFromEnv(value, f.Value); err != nil {
+			return &envconfig.ParseError{
+				KeyName:   f.EnvVar,
+				FieldName: f.Path[len(f.Path)-1],
+				TypeName:  f.Value.Type().String(),
+				Value:     value,
+				Err:       err,
+			}
+		}
+	}
+
+	return nil
+}
+
+// allocStructPtrs creates a zero value for every nil pointer to a struct, so
+// nested fields can be set from the environment.
+func allocStructPtrs(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		fv := v.Field(i)
+
+		if sf.PkgPath != "" || isTrue(sf.Tag.Get("ignored")) {
+			continue
+		}
+
+		for fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Struct && !isLeafStruct(fv.Type()) {
+			allocStructPtrs(fv)
+		}
+	}
+}
+
+func fieldAs(field reflect.Value, t reflect.Type) (interface{}, bool) {
+	if field.Type().Implements(t) {
+		return field.Interface(), true
+	}
+
+	if field.CanAddr() && field.Addr().Type().Implements(t) {
+		return field.Addr().Interface(), true
+	}
+
+	return nil, false
+}
+
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+// setFromEnv converts value to the type of field, as envconfig does.
+func setFromEnv(value string, field reflect.Value) error {
+	if d, ok := fieldAs(field, envDecoderType); ok {
+		return d.(envDecoder).Decode(value)
+	}
+
+	if s, ok := fieldAs(field, envSetterType); ok {
+		return s.(envSetter).Set(value)
+	}
+
+	if t, ok := fieldAs(field, textUnmarshalerType); ok {
+		return t.(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if b, ok := fieldAs(field, binaryUnmarshalerType); ok {
+		return b.(encoding.BinaryUnmarshaler).UnmarshalBinary([]byte(value))
+	}
+
+	typ := field.Type()
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+
+		if field.IsNil() {
+			field.Set(reflect.New(typ))
+		}
+
+		field = field.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var val int64
+		var err error
+
+		if typ == durationType {
+			var d time.Duration
+			d, err = time.ParseDuration(value)
+			val = int64(d)
+		} else {
+			val, err = strconv.ParseInt(value, 0, typ.Bits())
+		}
+
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, err := strconv.ParseUint(value, 0, typ.Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(val)
+	case reflect.Bool:
+		val, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(val)
+	case reflect.Float32, reflect.Float64:
+		val, err := strconv.ParseFloat(value, typ.Bits())
+
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(val)
+	case reflect.Slice:
+		sl := reflect.MakeSlice(typ, 0, 0)
+
+		if typ.Elem().Kind() == reflect.Uint8 {
+			sl = reflect.ValueOf([]byte(value))
+		} else if strings.TrimSpace(value) != "" {
+			vals := strings.Split(value, ",")
+			sl = reflect.MakeSlice(typ, len(vals), len(vals))
+
+			for i, val := range vals {
+				if err := setFromEnv(val, sl.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+
+		field.Set(sl)
+	case reflect.Map:
+		mp := reflect.MakeMap(typ)
+
+		if strings.TrimSpace(value) != "" {
+			for _, pair := range strings.Split(value, ",") {
+				kv := strings.Split(pair, ":")
+
+				if len(kv) != 2 {
+					return fmt.Errorf("invalid map item: %q", pair)
+				}
+
+				k := reflect.New(typ.Key()).Elem()
+				if err := setFromEnv(kv[0], k); err != nil {
+					return err
+				}
+
+				v := reflect.New(typ.Elem()).Elem()
+				if err := setFromEnv(kv[1], v); err != nil {
+					return err
+				}
+
+				mp.SetMapIndex(k, v)
+			}
+		}
+
+		field.Set(mp)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package clapp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEnvConf struct {
+	Timeout  time.Duration
+	Ratio    float64
+	Enabled  bool
+	Count    uint8
+	Tags     []string
+	Labels   map[string]int
+	Optional *int
+	Nested   *testExtEndpoint
+	Level    string `default:"info"`
+	APIToken string `split_words:"true"`
+	Skipped  string `ignored:"true"`
+}
+
+type testRequiredEnvConf struct {
+	Name string `envconfig:"NAME" required:"true"`
+}
+
+func TestProcessEnv(t *testing.T) {
+	cfg := &testEnvConf{}
+	err := processEnv("app", EnvconfigNaming, cfg, mapLookup(map[string]string{
+		"APP_TIMEOUT":         "1m30s",
+		"APP_RATIO":           "0.5",
+		"APP_ENABLED":         "true",
+		"APP_COUNT":           "0x10",
+		"APP_TAGS":            "a,b",
+		"APP_LABELS":          "x:1,y:2",
+		"APP_OPTIONAL":        "7",
+		"APP_NESTED_DOMAIN":   "example.com",
+		"APP_APITOKEN":        "nope",
+		"APP_API_TOKEN":       "split",
+		"APP_SKIPPED":         "nope",
+		"APP_NESTED_PROTOCOL": "https",
+	}))
+
+	seven := 7
+	assert.Nil(t, err)
+	assert.Equal(t, &testEnvConf{
+		Timeout:  90 * time.Second,
+		Ratio:    0.5,
+		Enabled:  true,
+		Count:    16,
+		Tags:     []string{"a", "b"},
+		Labels:   map[string]int{"x": 1, "y": 2},
+		Optional: &seven,
+		Nested: &testExtEndpoint{
+			Domain:   "example.com",
+			Protocol: "https",
+		},
+		Level:    "info",
+		APIToken: "split",
+	}, cfg)
+
+	err = processEnv("app", EnvconfigNaming, &testEnvConf{}, mapLookup(map[string]string{
+		"APP_COUNT": "300",
+	}))
+	assert.IsType(t, &envconfig.ParseError{}, err)
+	assert.Equal(t, "APP_COUNT", err.(*envconfig.ParseError).KeyName)
+
+	err = processEnv("app", EnvconfigNaming, &testRequiredEnvConf{}, mapLookup(map[string]string{}))
+	assert.Equal(t, "required key NAME missing value", err.Error())
+
+	required := &testRequiredEnvConf{}
+	assert.Nil(t, processEnv("app", EnvconfigNaming, required, mapLookup(map[string]string{"NAME": "alt"})))
+	assert.Equal(t, "alt", required.Name)
+
+	assert.Equal(t, envconfig.ErrInvalidSpecification, processEnv("app", EnvconfigNaming, testEnvConf{}, mapLookup(nil)))
+}
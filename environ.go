@@ -0,0 +1,59 @@
+package clapp
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Environ is a set of environment variables. When App.Environ is set it is
+// used in place of the process environment for everything clapp reads from
+// the environment, so tests don't need to call os.Setenv.
+type Environ map[string]string
+
+func (e Environ) Lookup(key string) (string, bool) {
+	v, ok := e[key]
+
+	return v, ok
+}
+
+func (e Environ) Get(key string) string {
+	return e[key]
+}
+
+// Names returns the variable names in sorted order.
+func (e Environ) Names() []string {
+	names := make([]string, 0, len(e))
+	for k := range e {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// OsEnviron returns a copy of the process environment.
+func OsEnviron() Environ {
+	e := Environ{}
+
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+
+		if len(parts) == 2 {
+			e[parts[0]] = parts[1]
+		}
+	}
+
+	return e
+}
+
+// lookupEnvFunc returns a lookup for e, falling back to the process
+// environment when it is nil so changes made after Run are still seen.
+func lookupEnvFunc(e Environ) func(string) (string, bool) {
+	if e == nil {
+		return os.LookupEnv
+	}
+
+	return e.Lookup
+}
@@ -0,0 +1,161 @@
+package clapp
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Environ(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/app.yaml", []byte("should-enable-this: ${FROM_FILE}\nshould-do-that: env:SECRET_VALUE\n"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/app.staging.yaml", []byte("list-of-things: [staging]\n"), 0644))
+
+	// set in the process environment but not in Environ, so it is ignored
+	os.Setenv("ENVIRONTEST_EXTERNAL_ENDPOINT_PROTOCOL", "ignored")
+	defer os.Unsetenv("ENVIRONTEST_EXTERNAL_ENDPOINT_PROTOCOL")
+
+	env := Environ{
+		"ENVIRONTEST_EXTERNAL_ENDPOINT_DOMAIN": "from-environ",
+		"ENVIRONTEST_PROFILE":                  "staging",
+		"FROM_FILE":                            "expanded",
+		"SECRET_VALUE":                         "resolved",
+		"NO_COLOR":                             "1",
+	}
+	cfg := &testConf{}
+	exec := &DummyExecutor{}
+
+	err := Run(App{
+		Config:                  cfg,
+		ConfigPath:              "/app.yaml",
+		Fs:                      fs,
+		Args:                    []string{},
+		Environ:                 env,
+		ResolveConfigReferences: true,
+		RootCommand: Command{
+			Name: "environtest",
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &testConf{
+		ShouldEnableThis: "expanded",
+		ShouldDoThat:     "resolved",
+		ExternalEndpoint: testExtEndpoint{
+			Domain: "from-environ",
+		},
+		ListOfThings: []string{"staging"},
+	}, cfg)
+	assert.Equal(t, env, EnvironFromContext(exec.ctx))
+	assert.True(t, LogManagerFromContext(exec.ctx).noColor)
+}
+
+func TestRun_EnvironUnknownVars(t *testing.T) {
+	t.Parallel()
+
+	err := Run(App{
+		Config: &testConf{},
+		Fs:     afero.NewMemMapFs(),
+		Args:   []string{},
+		Environ: Environ{
+			"ENVIRONUNKNOWN_NOPE": "x",
+		},
+		UnknownEnvVars: ErrorOnUnknownEnvVars,
+		RootCommand: Command{
+			Name: "environunknown",
+		},
+	}, &DummyExecutor{})
+
+	assert.Equal(t, ErrUnknownEnvVars{
+		Names: []string{"ENVIRONUNKNOWN_NOPE"},
+	}, err)
+}
+
+func TestEnviron(t *testing.T) {
+	env := Environ{
+		"B": "2",
+		"A": "",
+	}
+
+	v, ok := env.Lookup("A")
+	assert.Equal(t, "", v)
+	assert.True(t, ok)
+
+	_, ok = env.Lookup("C")
+	assert.False(t, ok)
+	assert.Equal(t, "2", env.Get("B"))
+	assert.Equal(t, []string{"A", "B"}, env.Names())
+
+	os.Setenv("CLAPP_OS_ENVIRON_TEST", "a=b")
+	defer os.Unsetenv("CLAPP_OS_ENVIRON_TEST")
+	assert.Equal(t, "a=b", OsEnviron().Get("CLAPP_OS_ENVIRON_TEST"))
+
+	assert.False(t, noColor(Environ{"NO_COLOR": ""}.Lookup))
+	assert.True(t, noColor(Environ{"NO_COLOR": "true"}.Lookup))
+}
+
+func TestRun_EnvPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		app       App
+		expectEnv Environ
+	}{
+		{
+			name: "command name is sanitised",
+			app: App{
+				RootCommand: Command{
+					Name: "my-tool",
+				},
+			},
+			expectEnv: Environ{
+				"MY_TOOL_SHOULD_DO_THAT": "set",
+				"MY_TOOL_PROFILE":        "",
+			},
+		},
+		{
+			name: "explicit prefix",
+			app: App{
+				EnvPrefix: "RENAMED",
+				RootCommand: Command{
+					Name: "my-tool",
+				},
+			},
+			expectEnv: Environ{
+				"RENAMED_SHOULD_DO_THAT": "set",
+			},
+		},
+		{
+			name: "field path naming",
+			app: App{
+				EnvNaming: FieldPathNaming,
+				RootCommand: Command{
+					Name: "tool",
+				},
+			},
+			expectEnv: Environ{
+				"TOOL_SHOULD_DO_THAT": "set",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			cfg := &testConf{}
+			app := test.app
+			app.Config = cfg
+			app.Fs = afero.NewMemMapFs()
+			app.Args = []string{}
+			app.Environ = test.expectEnv
+			app.UnknownEnvVars = ErrorOnUnknownEnvVars
+
+			assert.Nil(tt, Run(app, &DummyExecutor{}))
+			assert.Equal(tt, "set", cfg.ShouldDoThat)
+		})
+	}
+}
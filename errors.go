@@ -1,6 +1,10 @@
 package clapp
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type ErrIncorrectValueRefForFlag struct {
 	expectedType string
@@ -50,7 +54,15 @@ func (e ErrOverridingConfigWithEnvFailed) Error() string {
 	return fmt.Sprintf("failed to override config with env vars: %s", e.wrapped.Error())
 }
 
+func (e ErrOverridingConfigWithEnvFailed) Unwrap() error {
+	return e.wrapped
+}
+
+// ErrUnmarshallingYAML carries the position of the problem when the yaml
+// library reports one, Line and Column are 0 otherwise.
 type ErrUnmarshallingYAML struct {
+	Line    int
+	Column  int
 	wrapped error
 }
 
@@ -58,6 +70,10 @@ func (e ErrUnmarshallingYAML) Error() string {
 	return fmt.Sprintf("could not unmarshal config: %s", e.wrapped.Error())
 }
 
+func (e ErrUnmarshallingYAML) Unwrap() error {
+	return e.wrapped
+}
+
 type ErrReadingFile struct {
 	wrapped error
 }
@@ -65,3 +81,271 @@ type ErrReadingFile struct {
 func (e ErrReadingFile) Error() string {
 	return fmt.Sprintf("could not read config: %s", e.wrapped.Error())
 }
+
+func (e ErrReadingFile) Unwrap() error {
+	return e.wrapped
+}
+
+// ErrConfigFileNotFound matches ErrConfigNotFound when used with errors.Is.
+type ErrConfigFileNotFound struct {
+	Path    string
+	wrapped error
+}
+
+func (e ErrConfigFileNotFound) Error() string {
+	return fmt.Sprintf("config file %s does not exist", e.Path)
+}
+
+func (e ErrConfigFileNotFound) Unwrap() error {
+	return e.wrapped
+}
+
+func (e ErrConfigFileNotFound) Is(target error) bool {
+	return target == ErrConfigNotFound
+}
+
+type ErrConfigPermissionDenied struct {
+	Path    string
+	wrapped error
+}
+
+func (e ErrConfigPermissionDenied) Error() string {
+	return fmt.Sprintf("permission denied reading config file %s", e.Path)
+}
+
+func (e ErrConfigPermissionDenied) Unwrap() error {
+	return e.wrapped
+}
+
+type ErrConfigIsDirectory struct {
+	Path string
+}
+
+func (e ErrConfigIsDirectory) Error() string {
+	return fmt.Sprintf("config path %s is a directory", e.Path)
+}
+
+type ErrConfigSchemaViolations struct {
+	Violations []SchemaViolation
+}
+
+func (e ErrConfigSchemaViolations) Error() string {
+	msgs := []string{}
+
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+
+	return fmt.Sprintf("config does not match schema: %s", strings.Join(msgs, "; "))
+}
+
+type ErrUnknownEnvVars struct {
+	Names []string
+}
+
+func (e ErrUnknownEnvVars) Error() string {
+	return fmt.Sprintf("unknown environment variables: %s", strings.Join(e.Names, ", "))
+}
+
+type ErrUnresolvedReference struct {
+	Ref     string
+	wrapped error
+}
+
+func (e ErrUnresolvedReference) Error() string {
+	return fmt.Sprintf("could not resolve %s in config: %s", e.Ref, e.wrapped.Error())
+}
+
+func (e ErrUnresolvedReference) Unwrap() error {
+	return e.wrapped
+}
+
+type ErrConfigIncludeCycle struct {
+	Chain []string
+}
+
+func (e ErrConfigIncludeCycle) Error() string {
+	return fmt.Sprintf("config includes form a cycle: %s", strings.Join(e.Chain, " -> "))
+}
+
+type ErrInvalidConfig struct {
+	wrapped error
+}
+
+func (e ErrInvalidConfig) Error() string {
+	return fmt.Sprintf("config is not valid: %s", e.wrapped.Error())
+}
+
+func (e ErrInvalidConfig) Unwrap() error {
+	return e.wrapped
+}
+
+type ErrLoadingSource struct {
+	Source  string
+	wrapped error
+}
+
+func (e ErrLoadingSource) Error() string {
+	return fmt.Sprintf("failed to load config from source %s: %s", e.Source, e.wrapped.Error())
+}
+
+func (e ErrLoadingSource) Unwrap() error {
+	return e.wrapped
+}
+
+// ErrConflictingConfigKey is returned when Key can't be set because Conflict,
+// the key itself or one of its parents, already holds a different kind of
+// value e.g. files named a and a.b in a ConfigMapSource.
+type ErrConflictingConfigKey struct {
+	Key      string
+	Conflict string
+}
+
+func (e ErrConflictingConfigKey) Error() string {
+	return fmt.Sprintf("key %s conflicts with the value already set for %s", e.Key, e.Conflict)
+}
+
+type ErrParsingDotEnv struct {
+	Path    string
+	Line    int
+	wrapped error
+}
+
+func (e ErrParsingDotEnv) Error() string {
+	return fmt.Sprintf("failed to parse %s on line %d: %s", e.Path, e.Line, e.wrapped.Error())
+}
+
+func (e ErrParsingDotEnv) Unwrap() error {
+	return e.wrapped
+}
+
+type ErrLoadingCommandConfig struct {
+	Command string
+	wrapped error
+}
+
+func (e ErrLoadingCommandConfig) Error() string {
+	return fmt.Sprintf("failed to load config for command %s: %s", e.Command, e.wrapped.Error())
+}
+
+func (e ErrLoadingCommandConfig) Unwrap() error {
+	return e.wrapped
+}
+
+type ErrUnknownCommand struct {
+	Name        string
+	Parent      string
+	Suggestions []string
+}
+
+func (e ErrUnknownCommand) Error() string {
+	return fmt.Sprintf("unknown command %q for %q%s", e.Name, e.Parent, didYouMean(e.Suggestions, strconv.Quote))
+}
+
+type ErrUnknownFlag struct {
+	Name        string
+	Command     string
+	Suggestions []string
+}
+
+func (e ErrUnknownFlag) Error() string {
+	return fmt.Sprintf("unknown flag %s for %q%s", flagArg(e.Name), e.Command, didYouMean(e.Suggestions, flagArg))
+}
+
+// UnknownConfigKey is a key in the config file that doesn't map to a field.
+// Path is the full key e.g. server.prot, it is empty when the key could not
+// be found in the document.
+type UnknownConfigKey struct {
+	Key         string
+	Path        string
+	Line        int
+	Suggestions []string
+}
+
+func (k UnknownConfigKey) String() string {
+	return fmt.Sprintf("line %d: unknown config key %q%s", k.Line, k.Key, didYouMean(k.Suggestions, strconv.Quote))
+}
+
+type ErrUnknownConfigKeys struct {
+	Keys []UnknownConfigKey
+}
+
+func (e ErrUnknownConfigKeys) Error() string {
+	msgs := []string{}
+
+	for _, k := range e.Keys {
+		msgs = append(msgs, k.String())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+type ErrRequiredFlagsNotSet struct {
+	Names []string
+}
+
+func (e ErrRequiredFlagsNotSet) Error() string {
+	return fmt.Sprintf("required flag(s) \"%s\" not set", strings.Join(e.Names, "\", \""))
+}
+
+// ErrHandlerPanicked is returned when a command's handler panics, Value is
+// what was passed to panic and Stack is where it happened.
+type ErrHandlerPanicked struct {
+	Command string
+	Value   interface{}
+	Stack   []byte
+}
+
+func (e ErrHandlerPanicked) Error() string {
+	return fmt.Sprintf("command %s panicked: %s", e.Command, panicMessage(e.Value))
+}
+
+func (e ErrHandlerPanicked) ExitCode() int {
+	return PanicExitCode
+}
+
+// Unwrap returns the value passed to panic when it was an error.
+func (e ErrHandlerPanicked) Unwrap() error {
+	err, _ := e.Value.(error)
+
+	return err
+}
+
+type ErrUnknownCommandGroup struct {
+	Command string
+	Group   string
+}
+
+func (e ErrUnknownCommandGroup) Error() string {
+	return fmt.Sprintf("command %s is in group %s which its parent does not have", e.Command, e.Group)
+}
+
+type ErrInvalidHelpTemplate struct {
+	wrapped error
+}
+
+func (e ErrInvalidHelpTemplate) Error() string {
+	return fmt.Sprintf("invalid help template: %s", e.wrapped.Error())
+}
+
+func (e ErrInvalidHelpTemplate) Unwrap() error {
+	return e.wrapped
+}
+
+type ErrInvalidOutputFormat struct {
+	Format      OutputFormat
+	Suggestions []string
+}
+
+func (e ErrInvalidOutputFormat) Error() string {
+	return fmt.Sprintf("output format must be one of json, yaml, table, template, got %q%s", e.Format, didYouMean(e.Suggestions, strconv.Quote))
+}
+
+type ErrUnknownOutputColumn struct {
+	Column      string
+	Suggestions []string
+}
+
+func (e ErrUnknownOutputColumn) Error() string {
+	return fmt.Sprintf("unknown column %q%s", e.Column, didYouMean(e.Suggestions, strconv.Quote))
+}
@@ -11,15 +11,6 @@ import (
 	"github.com/svartlfheim/clapp"
 )
 
-func configPath() string {
-	if env, found := os.LookupEnv("EXAMPLE_CONFIG_PATH"); found {
-		return env
-	}
-
-	return ""
-}
-
-
 type myconfig struct {
 	GlobalVar string `envconfig:"GLOBAL_VAR" yaml:"global"`
 
@@ -41,8 +32,10 @@ var app clapp.App = clapp.App{
 	// The value must be a pointer to a struct (of any type)
 	Config: &appConf,
 
-	// The path to load the config file from
-	ConfigPath: configPath(), 
+	// The path to load the config file from, when empty ./<name>.yaml is used
+	// Users can load other files with the built in --config/-c flag, or the
+	// EXAMPLE_CONFIG env var, without any extra code
+	ConfigPath: "",
 	
 	// An error will be returned if the path defined is not found and this is true
 	// When this is false, the file will be used if found, but simply ignored if not
@@ -61,6 +54,22 @@ var app clapp.App = clapp.App{
 	// See: logger.go
 	Logger: zerolog.New(os.Stderr).With().Timestamp().Logger().Level(zerolog.InfoLevel),
 
+	// Shown by the version command and --version flag
+	// When empty the version is set with ldflags, or taken from the main module
+	Version: "1.1.1",
+
+	// Adds a version command and --version flag
+	VersionCommand: true,
+
+	// Replaces cobra's help with clapp's, which shows the env var and config key of each flag
+	// HelpAll adds a --help-all flag showing help for every command below the one given
+	Help: &clapp.HelpOptions{
+		HelpAll: true,
+	},
+
+	// Adds a --output/-o flag choosing the format of the printer from clapp.PrinterFromContext
+	OutputFlag: true,
+
 	// Define the root command of the app
 	// This is an abstraction on top of the underlying library (typically cobra, but may be extended)
 	RootCommand: clapp.Command{
@@ -151,7 +160,6 @@ child:
 			fmt.Printf("GlobalVar is:       %s\n", cfg.GlobalVar)
 			fmt.Printf("MyConfigVar var is: %s\n", cfg.MyConfigVar)
 			fmt.Printf("AnotherVar var is:  %s\n", anotherVar)
-			fmt.Printf("Command version is: %s\n", cmd.Version)
 
 			return nil
 		},
@@ -161,10 +169,27 @@ child:
 		// We don't have to provide every property of the command by allowing this
 		CustomConfiguration: func(cmd *cobra.Command) {
 			// Just an example of modifying the underlying command
-			cmd.Version = "1.1.1"
+			// Usage is not printed when the handler returns an error
+			cmd.SilenceUsage = true
 		},
 
 		Children: []clapp.Command{
+			{
+				Name: "config",
+				Descriptions: clapp.Descriptions{
+					Short: "Shows the loaded config in the format chosen with --output",
+				},
+				Handle: func(cmd *cobra.Command, args []string) error {
+					// The printer writes in the format given by --output e.g. -o json or -o table=GlobalVar
+					p, err := clapp.PrinterFromContext(cmd.Context())
+
+					if err != nil {
+						return err
+					}
+
+					return p.Print(clapp.ConfigFromContext(cmd.Context()))
+				},
+			},
 			{
 
 				// The name of the child command
@@ -207,19 +232,10 @@ child:
 					fmt.Printf("GlobalVar is:       %s\n", cfg.GlobalVar)
 					fmt.Printf("MyConfigVar var is: %s\n", cfg.MyConfigVar)
 					fmt.Printf("AnotherVar var is:  %s\n", anotherVar)
-					fmt.Printf("Command version is: %s\n", cmd.Version)
 					fmt.Printf("Required value is:  %d\n", required)
 		
 					return nil
 				},
-		
-				// This allows you to run a function on the underlying command
-				// It provides a way to do more complex operations on the underlying command
-				// We don't have to provide every property of the command by allowing this
-				CustomConfiguration: func(cmd *cobra.Command) {
-					// Just an example of modifying the underlying command
-					cmd.Version = "1.3.1"
-				},
 			},
 		},
 	},
@@ -243,13 +259,22 @@ Try running the following commands to see what values are in the configuration:
 	EXAMPLE_GLOBAL_VAR=blah go run main.go --global-var meh
 		defaults for everything except global-var which has a value of meh (the flag overrides the env var)
 
-	EXAMPLE_CONFIG_PATH=./config1.yaml go run main.go
+	go run main.go --config ./config1.yaml
 		global-var and my-config-var show the values defined in the config1.yaml file based on the yaml tags in the myconfig struct
 
-	EXAMPLE_CONFIG_PATH=./config1.yaml go run main.go --my-config-var meh
+	EXAMPLE_CONFIG=./config1.yaml go run main.go --my-config-var meh
 		my-config-var show the value from the flag
 		global-var shows the value from config1.yaml file based on the yaml tags in the myconfig struct
 
+	go run main.go -c ./config1.yaml -c ./example.yaml
+		the files are layered, values in example.yaml override those in config1.yaml
+
+	go run main.go version -f json
+		shows the version, along with the revision and build time when they are known
+
+	go run main.go config -o yaml
+		shows the loaded config as yaml, json, a table or a template e.g. -o template='{{.GlobalVar}}'
+
 Have a look in example.yaml to see how clapp loads a file by default based on the name of the root command.
 
 Try as many combinations of flags and configs as you like.
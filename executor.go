@@ -0,0 +1,150 @@
+package clapp
+
+import (
+	"context"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// The functions below are for executors that parse flags without cobra, such
+// as the one in the stdflag package, so they behave as CobraExecutor does.
+
+// CallHandler runs the handler of the command at path, the names of the
+// commands below root rather than their aliases. The handler is given a cobra
+// command set up from the tree, with ctx as its context and
+// CustomConfiguration applied, so its pre run hooks run and CommandPath is the
+// same as with CobraExecutor. Flags must already have been applied with
+// ApplyFlag.
+func CallHandler(ctx context.Context, root Command, path []string, args []string) error {
+	shell := &cobra.Command{}
+
+	// set before building so CustomConfiguration can replace them
+	shell.SetOut(StdoutFromContext(ctx))
+	shell.SetErr(StderrFromContext(ctx))
+
+	target, c, ok := buildShell(shell, root, path)
+
+	if !ok {
+		return unknownCommand(root, root.Name, strings.Join(path, " "))
+	}
+
+	handle := target.Handle
+
+	shell.SilenceErrors = true
+	shell.SilenceUsage = true
+	shell.SetArgs(path)
+
+	c.DisableFlagParsing = true
+	c.Args = cobra.ArbitraryArgs
+	c.RunE = func(cmd *cobra.Command, _ []string) error {
+		return handle(cmd, args)
+	}
+
+	return shell.ExecuteContext(ctx)
+}
+
+// buildShell sets up c and its children from cmd, without any flags, and
+// returns the command at path along with its cobra command.
+func buildShell(c *cobra.Command, cmd Command, path []string) (Command, *cobra.Command, bool) {
+	c.Use = cmd.Name
+	c.Short = cmd.Descriptions.Short
+	c.Long = cmd.Descriptions.Long
+	configureCommand(c, cmd)
+
+	found, foundShell, ok := cmd, c, len(path) == 0
+
+	for _, child := range cmd.Children {
+		cc := &cobra.Command{}
+		c.AddCommand(cc)
+
+		if len(path) > 0 && child.Name == path[0] {
+			found, foundShell, ok = buildShell(cc, child, path[1:])
+			continue
+		}
+
+		buildShell(cc, child, nil)
+	}
+
+	if cmd.CustomConfiguration != nil {
+		cmd.CustomConfiguration(c)
+	}
+
+	return found, foundShell, ok
+}
+
+// ApplyFlag copies the value parsed for a flag that was given on the command
+// line to its ValueRef, and writes it to the debug log with secrets masked.
+// command is the path of the command that is running. The value is kept when
+// the config is reloaded.
+func ApplyFlag(ctx context.Context, command string, f Flag, parsed interface{}) {
+	if lm, ok := ctx.Value(LogManagerContextKey).(*LogManager); ok {
+		v := flagDefault(parsed)
+
+		// formatted as pflag formats slices, as CobraExecutor logs them
+		switch parsed.(type) {
+		case *[]string, *[]int:
+			v = "[" + v + "]"
+		}
+
+		if isSecretFlag(f, ConfigFromContext(ctx)) {
+			v = maskSecret(v)
+		}
+
+		lm.logger.Debug().Str("command", command).Str("flag", f.Name).Str("value", v).Msg("flag set")
+	}
+
+	applyFlag(ctx, f.ValueRef, parsed)
+}
+
+// isSecretFlag reports whether f is marked as a secret, or is bound to a
+// secret field of cfg.
+func isSecretFlag(f Flag, cfg interface{}) bool {
+	if f.Secret {
+		return true
+	}
+
+	// the config is only used to find secrets, so an invalid one is ignored
+	fields, _ := collectConfigFields(cfg, "")
+	cf, bound := configFieldForRef(fields, f.ValueRef)
+
+	return bound && cf.Secret()
+}
+
+// WriteHelp writes help for the command at path, the names or aliases of the
+// commands below root. The renderer of App.Help is used when it is set,
+// otherwise help is written in the same layout as cobra's.
+func WriteHelp(ctx context.Context, w io.Writer, root Command, path []string) error {
+	cmd, full := root, root.Name
+
+	for _, name := range path {
+		child, ok := childNamed(cmd, name)
+
+		if !ok {
+			return unknownCommand(cmd, full, name)
+		}
+
+		cmd, full = child, full+" "+child.Name
+	}
+
+	h := helpRendererFromContext(ctx)
+
+	if h == nil {
+		fields, _ := collectConfigFields(ConfigFromContext(ctx), "")
+		defaults, _ := collectConfigFields(ConfigManagerFromContext(ctx).builtinDefaults(), "")
+
+		// the default template always parses
+		h, _ = newHelpRenderer(HelpOptions{}, root, fields, defaults, lookupEnvFunc(EnvironFromContext(ctx)), w)
+
+		// cobra's help isn't wrapped, and doesn't show where flags are loaded
+		// from
+		h.width = math.MaxInt32
+		h.sources = false
+	}
+
+	_, err := h.render(w, path)
+
+	return err
+}
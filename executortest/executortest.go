@@ -0,0 +1,600 @@
+// Package executortest checks that an implementation of clapp.Executor
+// behaves the same as the executors provided by clapp.
+//
+//	func TestMyExecutor(t *testing.T) {
+//		executortest.Run(t, func() clapp.Executor {
+//			return NewMyExecutor()
+//		})
+//	}
+package executortest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/svartlfheim/clapp"
+)
+
+var errHandler error = errors.New("handler failed")
+
+type contextKey string
+
+const initialContextKey contextKey = "executortest"
+
+type config struct {
+	Setting string `yaml:"setting" envconfig:"SETTING"`
+}
+
+// values records what a handler was given.
+type values struct {
+	Ran      string
+	Args     []string
+	Name     string
+	Names    []string
+	Count    int
+	Counts   []int
+	Verbose  bool
+	Region   string
+	Required string
+	Setting  string
+	Initial  interface{}
+
+	// PreRunSetting is the config's Setting as a pre run hook saw it
+	PreRunSetting string
+}
+
+type testCase struct {
+	name        string
+	args        []string
+	expected    values
+	expectedOut []string
+	hiddenOut   []string
+	err         error
+	anyErr      bool
+}
+
+// buildApp has a root command with every flag type, a grouped child with a
+// required flag and an alias, a grandchild, a child without a handler, a
+// failing child, a panicking child, a hidden child and a deprecated child.
+func buildApp(fs afero.Fs, args []string, out *bytes.Buffer, got *values) clapp.App {
+	cfg := &config{
+		Setting: "builtin",
+	}
+	vals := &values{
+		Name:   "default-name",
+		Count:  1,
+		Region: "eu",
+	}
+
+	record := func(name string) clapp.HandlerFunc {
+		return func(cmd *cobra.Command, a []string) error {
+			*got = *vals
+			got.Ran = name
+			got.Args = a
+			got.Setting = clapp.ConfigFromContext(cmd.Context()).(*config).Setting
+			got.Initial = cmd.Context().Value(initialContextKey)
+
+			return nil
+		}
+	}
+
+	return clapp.App{
+		Config:         cfg,
+		ConfigPath:     "/executortest.yaml",
+		Fs:             fs,
+		Args:           args,
+		Environ:        clapp.Environ{},
+		Stdout:         out,
+		Stderr:         out,
+		InitialContext: context.WithValue(context.Background(), initialContextKey, "initial"),
+		RootCommand: clapp.Command{
+			Name: "conform",
+			Descriptions: clapp.Descriptions{
+				Short: "Conformance app",
+			},
+			Example: "  conform --name bob",
+			Groups: []clapp.CommandGroup{
+				{
+					ID:    "main",
+					Title: "Main Commands",
+				},
+			},
+			PersistentFlags: []clapp.Flag{
+				{
+					Name:        "region",
+					Short:       "r",
+					Description: "Region",
+					ValueRef:    &vals.Region,
+					Type:        clapp.StringFlag,
+				},
+			},
+			LocalFlags: []clapp.Flag{
+				{
+					Name:        "name",
+					Short:       "n",
+					Description: "Name",
+					ValueRef:    &vals.Name,
+					Type:        clapp.StringFlag,
+				},
+				{
+					Name:        "names",
+					Description: "Names",
+					ValueRef:    &vals.Names,
+					Type:        clapp.StringSliceFlag,
+				},
+				{
+					Name:        "count",
+					Short:       "c",
+					Description: "Count",
+					ValueRef:    &vals.Count,
+					Type:        clapp.IntFlag,
+				},
+				{
+					Name:        "counts",
+					Description: "Counts",
+					ValueRef:    &vals.Counts,
+					Type:        clapp.IntSliceFlag,
+				},
+				{
+					Name:        "verbose",
+					Short:       "v",
+					Description: "Verbose",
+					ValueRef:    &vals.Verbose,
+					Type:        clapp.BoolFlag,
+				},
+				{
+					Name:        "setting",
+					Description: "Setting",
+					ValueRef:    &cfg.Setting,
+					Type:        clapp.StringFlag,
+				},
+			},
+			Handle: record("conform"),
+			CustomConfiguration: func(cmd *cobra.Command) {
+				cmd.PersistentPreRunE = func(cmd *cobra.Command, a []string) error {
+					vals.PreRunSetting = cfg.Setting
+					return nil
+				}
+			},
+			Children: []clapp.Command{
+				{
+					Name:    "child",
+					Aliases: []string{"kid"},
+					Group:   "main",
+					Descriptions: clapp.Descriptions{
+						Short: "A child",
+					},
+					LocalFlags: []clapp.Flag{
+						{
+							Name:        "required",
+							Description: "Required",
+							ValueRef:    &vals.Required,
+							Type:        clapp.StringFlag,
+							Required:    true,
+						},
+					},
+					Handle: record("child"),
+					Children: []clapp.Command{
+						{
+							Name:   "grandchild",
+							Handle: record("grandchild"),
+						},
+					},
+				},
+				{
+					Name: "group",
+					Descriptions: clapp.Descriptions{
+						Short: "Has no handler",
+					},
+				},
+				{
+					Name: "fail",
+					Handle: func(cmd *cobra.Command, a []string) error {
+						return errHandler
+					},
+				},
+				{
+					Name: "panic",
+					Handle: func(cmd *cobra.Command, a []string) error {
+						panic("handler panicked")
+					},
+				},
+				{
+					Name:   "hidden",
+					Handle: record("hidden"),
+					Hidden: true,
+				},
+				{
+					Name:       "old",
+					Handle:     record("old"),
+					Deprecated: "use child instead",
+				},
+			},
+		},
+	}
+}
+
+// expect fills in the values every handler sees when no flags are given.
+func expect(v values) values {
+	if v.Args == nil {
+		v.Args = []string{}
+	}
+
+	if v.Name == "" {
+		v.Name = "default-name"
+	}
+
+	if v.Count == 0 {
+		v.Count = 1
+	}
+
+	if v.Region == "" {
+		v.Region = "eu"
+	}
+
+	if v.Setting == "" {
+		v.Setting = "from-file"
+	}
+
+	if v.PreRunSetting == "" {
+		v.PreRunSetting = v.Setting
+	}
+
+	v.Initial = "initial"
+
+	return v
+}
+
+var cases = []testCase{
+	{
+		name: "runs the root command",
+		args: []string{},
+		expected: expect(values{
+			Ran: "conform",
+		}),
+	},
+	{
+		name: "parses long flags of every type",
+		args: []string{"--name", "bob", "--names", "a,b", "--count", "3", "--counts", "1,2", "--verbose", "--region=us"},
+		expected: expect(values{
+			Ran:     "conform",
+			Name:    "bob",
+			Names:   []string{"a", "b"},
+			Count:   3,
+			Counts:  []int{1, 2},
+			Verbose: true,
+			Region:  "us",
+		}),
+	},
+	{
+		name: "parses short flags",
+		args: []string{"-n", "bob", "-c", "3", "-v", "-r", "us"},
+		expected: expect(values{
+			Ran:     "conform",
+			Name:    "bob",
+			Count:   3,
+			Verbose: true,
+			Region:  "us",
+		}),
+	},
+	{
+		name: "appends repeated slice flags",
+		args: []string{"--names", "a", "--names", "b,c", "--counts", "1", "--counts", "2"},
+		expected: expect(values{
+			Ran:    "conform",
+			Names:  []string{"a", "b", "c"},
+			Counts: []int{1, 2},
+		}),
+	},
+	{
+		name: "replaces config values with flags that are given",
+		args: []string{"--setting", "from-flag"},
+		expected: expect(values{
+			Ran:     "conform",
+			Setting: "from-flag",
+		}),
+	},
+	{
+		name: "applies flags before pre run hooks",
+		args: []string{"--setting", "from-flag"},
+		expected: expect(values{
+			Ran:           "conform",
+			Setting:       "from-flag",
+			PreRunSetting: "from-flag",
+		}),
+	},
+	{
+		name: "passes positional args to children",
+		args: []string{"child", "--required", "yes", "one", "two"},
+		expected: expect(values{
+			Ran:      "child",
+			Args:     []string{"one", "two"},
+			Required: "yes",
+		}),
+	},
+	{
+		name: "inherits persistent flags",
+		args: []string{"child", "grandchild", "--region", "us"},
+		expected: expect(values{
+			Ran:    "grandchild",
+			Region: "us",
+		}),
+	},
+	{
+		name: "accepts persistent flags before the child",
+		args: []string{"--region", "us", "child", "grandchild"},
+		expected: expect(values{
+			Ran:    "grandchild",
+			Region: "us",
+		}),
+	},
+	{
+		name: "runs hidden commands",
+		args: []string{"hidden"},
+		expected: expect(values{
+			Ran: "hidden",
+		}),
+	},
+	{
+		name: "runs commands by alias",
+		args: []string{"kid", "--required", "yes"},
+		expected: expect(values{
+			Ran:      "child",
+			Required: "yes",
+		}),
+	},
+	{
+		name: "runs deprecated commands",
+		args: []string{"old"},
+		expected: expect(values{
+			Ran: "old",
+		}),
+	},
+	{
+		name:   "fails when required flags are missing",
+		args:   []string{"child"},
+		anyErr: true,
+	},
+	{
+		name:   "fails on unknown flags",
+		args:   []string{"--nope"},
+		anyErr: true,
+	},
+	{
+		name:   "fails on invalid int flags",
+		args:   []string{"--count", "three"},
+		anyErr: true,
+	},
+	{
+		name:   "fails on unknown commands",
+		args:   []string{"nope"},
+		anyErr: true,
+	},
+	{
+		name: "returns handler errors",
+		args: []string{"fail"},
+		err:  errHandler,
+	},
+	{
+		name: "lists flags and visible commands in help",
+		args: []string{"--help"},
+		expectedOut: []string{
+			"Conformance app",
+			"conform [command]",
+			"child",
+			"A child",
+			"--name",
+			"--names",
+			"--count",
+			"--counts",
+			"--verbose",
+			"--region",
+			"Main Commands:\n  child",
+			"Additional Commands:",
+			"Examples:\n  conform --name bob",
+		},
+		hiddenOut: []string{"hidden", "old", "Available Commands:"},
+	},
+	{
+		name: "shows inherited flags in help",
+		args: []string{"child", "--help"},
+		expectedOut: []string{
+			"--required",
+			"--region",
+			"grandchild",
+			"Aliases:\n  child, kid",
+			"Available Commands:",
+		},
+		hiddenOut: []string{"--verbose"},
+	},
+	{
+		name: "shows help when there is no handler",
+		args: []string{"group"},
+		expectedOut: []string{
+			"Has no handler",
+			"--region",
+		},
+	},
+}
+
+// Run runs every behaviour an Executor must share with clapp's executors as a
+// subtest of t. newExecutor is called once for each case.
+func Run(t *testing.T, newExecutor func() clapp.Executor) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/executortest.yaml", []byte("setting: from-file\n"), 0644))
+
+	for _, test := range cases {
+		test := test
+
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			got := values{}
+
+			err := clapp.Run(buildApp(fs, test.args, out, &got), newExecutor())
+
+			switch {
+			case test.anyErr:
+				assert.Error(tt, err)
+				return
+			case test.err != nil:
+				assert.True(tt, errors.Is(err, test.err), "expected %v, got %v", test.err, err)
+				return
+			}
+
+			assert.Nil(tt, err)
+
+			for _, s := range test.expectedOut {
+				assert.Contains(tt, out.String(), s)
+			}
+
+			for _, s := range test.hiddenOut {
+				assert.NotContains(tt, out.String(), s)
+			}
+
+			if test.expectedOut == nil {
+				assert.Equal(tt, test.expected, got)
+			}
+		})
+	}
+
+	t.Run("recovers handler panics", func(tt *testing.T) {
+		err := clapp.Run(buildApp(fs, []string{"panic"}, &bytes.Buffer{}, &values{}), newExecutor())
+
+		var panicked clapp.ErrHandlerPanicked
+		assert.True(tt, errors.As(err, &panicked), "got %v", err)
+		assert.Equal(tt, "conform panic", panicked.Command)
+		assert.Equal(tt, clapp.PanicExitCode, clapp.ExitCode(err))
+	})
+
+	t.Run("suggests commands", func(tt *testing.T) {
+		err := clapp.Run(buildApp(fs, []string{"chld"}, &bytes.Buffer{}, &values{}), newExecutor())
+
+		var unknown clapp.ErrUnknownCommand
+		assert.True(tt, errors.As(err, &unknown), "got %v", err)
+		assert.Equal(tt, "chld", unknown.Name)
+		assert.Equal(tt, []string{"child"}, unknown.Suggestions)
+	})
+
+	t.Run("suggests flags", func(tt *testing.T) {
+		err := clapp.Run(buildApp(fs, []string{"child", "--reqired", "yes"}, &bytes.Buffer{}, &values{}), newExecutor())
+
+		var unknown clapp.ErrUnknownFlag
+		assert.True(tt, errors.As(err, &unknown), "got %v", err)
+		assert.Equal(tt, "reqired", unknown.Name)
+		assert.Equal(tt, "conform child", unknown.Command)
+		assert.Equal(tt, []string{"required"}, unknown.Suggestions)
+	})
+
+	t.Run("prints unknown commands once", func(tt *testing.T) {
+		out := &bytes.Buffer{}
+		err := clapp.Run(buildApp(fs, []string{"chld"}, out, &values{}), newExecutor())
+
+		assert.Error(tt, err)
+		assert.Equal(tt, 1, strings.Count(out.String(), err.Error()), out.String())
+		assert.Contains(tt, out.String(), "Run 'conform --help' for usage.")
+	})
+
+	t.Run("prints missing required flags", func(tt *testing.T) {
+		out := &bytes.Buffer{}
+		err := clapp.Run(buildApp(fs, []string{"child"}, out, &values{}), newExecutor())
+
+		assert.Error(tt, err)
+		assert.Equal(tt, 1, strings.Count(out.String(), err.Error()), out.String())
+	})
+
+	helps := map[string]*clapp.HelpOptions{
+		"without App.Help": nil,
+		"with App.Help":    {Width: 200},
+	}
+
+	for name, help := range helps {
+		help := help
+		t.Run("shows the built-in default in help "+name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			a := buildApp(fs, []string{"--help"}, out, &values{})
+			a.Help = help
+
+			err := clapp.Run(a, newExecutor())
+
+			assert.Nil(tt, err)
+			assert.Contains(tt, out.String(), `(built-in default "builtin") (default "from-file")`)
+		})
+	}
+
+	t.Run("uses the help renderer of App.Help", func(tt *testing.T) {
+		out := &bytes.Buffer{}
+		a := buildApp(fs, []string{"--help"}, out, &values{})
+		a.Help = &clapp.HelpOptions{}
+
+		err := clapp.Run(a, newExecutor())
+
+		assert.Nil(tt, err)
+		assert.Contains(tt, out.String(), "[env: CONFORM_SETTING, config: setting]")
+	})
+
+	for _, args := range [][]string{{"--output", "json"}, {"-o", "json"}, {"-o=json"}} {
+		args := args
+
+		t.Run("prints in the format given by "+args[0], func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			a := buildApp(fs, args, out, &values{})
+			a.OutputFlag = true
+			a.RootCommand.Handle = func(cmd *cobra.Command, args []string) error {
+				p, err := clapp.PrinterFromContext(cmd.Context())
+
+				if err != nil {
+					return err
+				}
+
+				return p.Print(map[string]string{
+					"name": "web",
+				})
+			}
+
+			err := clapp.Run(a, newExecutor())
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, "{\n  \"name\": \"web\"\n}\n", out.String())
+		})
+	}
+
+	t.Run("fails to build flags with the wrong ValueRef", func(tt *testing.T) {
+		runInvalidFlag(tt, newExecutor(), clapp.StringFlag, &clapp.ErrIncorrectValueRefForFlag{})
+	})
+
+	t.Run("fails to build flags of unknown types", func(tt *testing.T) {
+		runInvalidFlag(tt, newExecutor(), clapp.ValueType("float"), &clapp.ErrFlagTypeNotImplemented{})
+	})
+}
+
+func runInvalidFlag(t *testing.T, e clapp.Executor, vt clapp.ValueType, target interface{}) {
+	notString := 1
+
+	err := clapp.Run(clapp.App{
+		Config:  &config{},
+		Fs:      afero.NewMemMapFs(),
+		Args:    []string{},
+		Environ: clapp.Environ{},
+		RootCommand: clapp.Command{
+			Name: "invalid",
+			LocalFlags: []clapp.Flag{
+				{
+					Name:     "invalid",
+					ValueRef: &notString,
+					Type:     vt,
+				},
+			},
+			Handle: func(cmd *cobra.Command, args []string) error {
+				return nil
+			},
+		},
+	}, e)
+
+	assert.True(t, errors.As(err, target), "got %v", err)
+}
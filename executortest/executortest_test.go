@@ -0,0 +1,13 @@
+package executortest
+
+import (
+	"testing"
+
+	"github.com/svartlfheim/clapp"
+)
+
+func TestCobraExecutor(t *testing.T) {
+	Run(t, func() clapp.Executor {
+		return clapp.NewCobraExecutor()
+	})
+}
@@ -0,0 +1,24 @@
+package clapp
+
+import "errors"
+
+// ExitCoder can be implemented by errors returned from handlers to choose the
+// code the process exits with.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitCode returns the code to exit with for an error returned by Run. This
+// is 0 for nil, the code of the first ExitCoder in the chain, or 1.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var coder ExitCoder
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+
+	return 1
+}
@@ -0,0 +1,56 @@
+package clapp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testExitError struct {
+	code int
+}
+
+func (e testExitError) Error() string {
+	return fmt.Sprintf("exit %d", e.code)
+}
+
+func (e testExitError) ExitCode() int {
+	return e.code
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{
+			name:     "nil is success",
+			err:      nil,
+			expected: 0,
+		},
+		{
+			name:     "plain errors are 1",
+			err:      errors.New("failed"),
+			expected: 1,
+		},
+		{
+			name:     "exit coders choose the code",
+			err:      testExitError{code: 3},
+			expected: 3,
+		},
+		{
+			name:     "wrapped exit coders choose the code",
+			err:      fmt.Errorf("wrapped: %w", testExitError{code: 4}),
+			expected: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, ExitCode(test.err))
+		})
+	}
+}
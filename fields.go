@@ -0,0 +1,292 @@
+package clapp
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var wordsRegexp = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+var acronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+
+// configField describes a single settable value within a config struct and
+// the keys (yaml and env) that it can be populated from.
+type configField struct {
+	Path     []string
+	YAMLPath []string
+	EnvVar   string
+	EnvAlt   string
+	Type     reflect.Type
+	Tag      reflect.StructTag
+
+	// Value is invalid when the field sits beneath a nil pointer
+	Value reflect.Value
+}
+
+func (f configField) Name() string {
+	return strings.Join(f.Path, ".")
+}
+
+func (f configField) YAMLKey() string {
+	return strings.Join(f.YAMLPath, ".")
+}
+
+func (f configField) TypeName() string {
+	return f.Type.String()
+}
+
+func (f configField) Required() bool {
+	return isTrue(f.Tag.Get("required"))
+}
+
+func (f configField) Description() string {
+	return f.Tag.Get("desc")
+}
+
+func (f configField) DefaultValue() string {
+	if def := f.Tag.Get("default"); def != "" {
+		return def
+	}
+
+	if !f.Value.IsValid() || f.Value.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprint(f.Value.Interface())
+}
+
+func isTrue(s string) bool {
+	return strings.EqualFold(s, "true")
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+type envDecoder interface {
+	Decode(value string) error
+}
+
+type envSetter interface {
+	Set(value string) error
+}
+
+var envDecoderType = reflect.TypeOf((*envDecoder)(nil)).Elem()
+var envSetterType = reflect.TypeOf((*envSetter)(nil)).Elem()
+
+// isLeafStruct reports whether a struct type decodes itself, in which case
+// it is treated as a single value rather than a set of nested fields.
+func isLeafStruct(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+
+	pt := reflect.PtrTo(t)
+
+	return pt.Implements(textUnmarshalerType) ||
+		pt.Implements(envDecoderType) ||
+		pt.Implements(envSetterType)
+}
+
+func splitWords(name string) string {
+	words := wordsRegexp.FindAllStringSubmatch(name, -1)
+
+	if len(words) == 0 {
+		return name
+	}
+
+	parts := []string{}
+	for _, w := range words {
+		if m := acronymRegexp.FindStringSubmatch(w[0]); len(m) == 3 {
+			parts = append(parts, m[1], m[2])
+			continue
+		}
+
+		parts = append(parts, w[0])
+	}
+
+	return strings.Join(parts, "_")
+}
+
+func yamlName(sf reflect.StructField) (name string, inline bool, skip bool) {
+	tag := sf.Tag.Get("yaml")
+
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			inline = true
+		}
+	}
+
+	if parts[0] != "" {
+		return parts[0], inline, false
+	}
+
+	return strings.ToLower(sf.Name), inline, false
+}
+
+// EnvNaming decides the env var name of fields without an envconfig tag.
+type EnvNaming string
+
+// EnvconfigNaming uses the upper cased field name, or its words separated by
+// underscores when the field is tagged split_words:"true", e.g. APP_LOGLEVEL
+const EnvconfigNaming EnvNaming = ""
+
+// FieldPathNaming always separates the words of each field in the path to
+// the value, e.g. APP_EXTERNAL_ENDPOINT_LOG_LEVEL
+const FieldPathNaming EnvNaming = "field-path"
+
+var invalidEnvCharsRegexp = regexp.MustCompile("[^A-Z0-9_]+")
+
+// sanitiseEnvPrefix turns a name, such as that of the root command, into a
+// valid env var prefix e.g. my-tool becomes MY_TOOL.
+func sanitiseEnvPrefix(name string) string {
+	prefix := strings.Trim(invalidEnvCharsRegexp.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+
+	if prefix != "" && prefix[0] >= '0' && prefix[0] <= '9' {
+		prefix = "_" + prefix
+	}
+
+	return prefix
+}
+
+// envName mirrors the naming rules used by envconfig so the documented
+// variables match the ones that are actually read.
+func envName(prefix string, sf reflect.StructField, naming EnvNaming) (key string, alt string) {
+	alt = strings.ToUpper(sf.Tag.Get("envconfig"))
+	key = sf.Name
+
+	if isTrue(sf.Tag.Get("split_words")) || naming == FieldPathNaming {
+		key = splitWords(sf.Name)
+	}
+
+	if alt != "" {
+		key = alt
+	}
+
+	if prefix != "" {
+		key = fmt.Sprintf("%s_%s", prefix, key)
+	}
+
+	return strings.ToUpper(key), alt
+}
+
+func collectConfigFields(cfg interface{}, envPrefix string) ([]configField, error) {
+	return collectEnvConfigFields(cfg, envPrefix, EnvconfigNaming)
+}
+
+func collectEnvConfigFields(cfg interface{}, envPrefix string, naming EnvNaming) ([]configField, error) {
+	rval := reflect.ValueOf(cfg)
+
+	if rval.Kind() != reflect.Ptr {
+		return nil, ErrConfigMustBeAPointer
+	}
+
+	rval = rval.Elem()
+	if rval.Kind() != reflect.Struct {
+		return nil, ErrConfigMustPointToAStruct
+	}
+
+	return walkConfigStruct(rval.Type(), rval, nil, nil, envPrefix, naming), nil
+}
+
+func walkConfigStruct(t reflect.Type, v reflect.Value, path []string, yamlPath []string, envPrefix string, naming EnvNaming) []configField {
+	fields := []configField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		// unexported fields can't be set by any of the loaders
+		if sf.PkgPath != "" || isTrue(sf.Tag.Get("ignored")) {
+			continue
+		}
+
+		ft := sf.Type
+		var fv reflect.Value
+
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+
+		for ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			ft = ft.Elem()
+
+			if fv.IsValid() {
+				if fv.IsNil() {
+					fv = reflect.Value{}
+				} else {
+					fv = fv.Elem()
+				}
+			}
+		}
+
+		key, alt := envName(envPrefix, sf, naming)
+		yName, inline, skipYAML := yamlName(sf)
+
+		fieldPath := append(append([]string{}, path...), sf.Name)
+		fieldYAMLPath := append([]string{}, yamlPath...)
+
+		if !skipYAML && !inline {
+			fieldYAMLPath = append(fieldYAMLPath, yName)
+		}
+
+		if ft.Kind() == reflect.Struct && !isLeafStruct(ft) {
+			innerPrefix := envPrefix
+			if !sf.Anonymous {
+				innerPrefix = key
+			}
+
+			if skipYAML {
+				fieldYAMLPath = nil
+			}
+
+			fields = append(fields, walkConfigStruct(ft, fv, fieldPath, fieldYAMLPath, innerPrefix, naming)...)
+			continue
+		}
+
+		if skipYAML {
+			fieldYAMLPath = nil
+		}
+
+		fields = append(fields, configField{
+			Path:     fieldPath,
+			YAMLPath: fieldYAMLPath,
+			EnvVar:   key,
+			EnvAlt:   alt,
+			Type:     sf.Type,
+			Tag:      sf.Tag,
+			Value:    fv,
+		})
+	}
+
+	return fields
+}
+
+// configFieldForRef finds the config field that a flag's ValueRef points at,
+// if any.
+func configFieldForRef(fields []configField, ref interface{}) (configField, bool) {
+	rv := reflect.ValueOf(ref)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return configField{}, false
+	}
+
+	for _, f := range fields {
+		if !f.Value.IsValid() || !f.Value.CanAddr() {
+			continue
+		}
+
+		addr := f.Value.Addr()
+		if addr.Type() == rv.Type() && addr.Pointer() == rv.Pointer() {
+			return f, true
+		}
+	}
+
+	return configField{}, false
+}
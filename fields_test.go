@@ -0,0 +1,136 @@
+package clapp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNestedFieldsConf struct {
+	Inner struct {
+		Value string `yaml:"value"`
+	} `yaml:"inner" envconfig:"INNER"`
+	Pointer *struct {
+		Deep int `yaml:"deep" envconfig:"DEEP"`
+	} `yaml:"pointer"`
+	SplitWordsField string        `split_words:"true"`
+	Timeout         time.Duration `yaml:"timeout"`
+	Skipped         string        `yaml:"-"`
+	Ignored         string        `ignored:"true"`
+	unexported      string
+}
+
+func TestCollectConfigFields(t *testing.T) {
+	fields, err := collectConfigFields(&testConf{}, "blah")
+
+	assert.Nil(t, err)
+
+	got := [][]string{}
+	for _, f := range fields {
+		got = append(got, []string{f.Name(), f.YAMLKey(), f.EnvVar})
+	}
+
+	assert.Equal(t, [][]string{
+		{"ShouldEnableThis", "should-enable-this", "BLAH_SHOULD_ENABLE_THIS"},
+		{"ShouldDoThat", "should-do-that", "BLAH_SHOULD_DO_THAT"},
+		{"ExternalEndpoint.Protocol", "external-endpoint.protocol", "BLAH_EXTERNAL_ENDPOINT_PROTOCOL"},
+		{"ExternalEndpoint.Domain", "external-endpoint.domain", "BLAH_EXTERNAL_ENDPOINT_DOMAIN"},
+		{"ExternalEndpoint.Port", "external-endpoint.port", "BLAH_EXTERNAL_ENDPOINT_PORT"},
+		{"ListOfThings", "list-of-things", "BLAH_LIST_OF_THINGS"},
+	}, got)
+}
+
+func TestCollectConfigFields_NestedAndSkipped(t *testing.T) {
+	fields, err := collectConfigFields(&testNestedFieldsConf{}, "app")
+
+	assert.Nil(t, err)
+
+	got := [][]string{}
+	for _, f := range fields {
+		got = append(got, []string{f.Name(), f.YAMLKey(), f.EnvVar})
+	}
+
+	assert.Equal(t, [][]string{
+		{"Inner.Value", "inner.value", "APP_INNER_VALUE"},
+		{"Pointer.Deep", "pointer.deep", "APP_POINTER_DEEP"},
+		{"SplitWordsField", "splitwordsfield", "APP_SPLIT_WORDS_FIELD"},
+		{"Timeout", "timeout", "APP_TIMEOUT"},
+		{"Skipped", "", "APP_SKIPPED"},
+	}, got)
+
+	// nil pointers are not allocated while walking
+	assert.False(t, fields[1].Value.IsValid())
+}
+
+func TestCollectConfigFields_Errors(t *testing.T) {
+	_, err := collectConfigFields(testConf{}, "blah")
+	assert.Equal(t, ErrConfigMustBeAPointer, err)
+
+	_, err = collectConfigFields(&[]string{}, "blah")
+	assert.Equal(t, ErrConfigMustPointToAStruct, err)
+}
+
+func TestConfigFieldForRef(t *testing.T) {
+	cfg := &testConf{}
+	fields, err := collectConfigFields(cfg, "blah")
+
+	assert.Nil(t, err)
+
+	f, ok := configFieldForRef(fields, &cfg.ExternalEndpoint.Domain)
+	assert.True(t, ok)
+	assert.Equal(t, "ExternalEndpoint.Domain", f.Name())
+
+	other := ""
+	_, ok = configFieldForRef(fields, &other)
+	assert.False(t, ok)
+
+	_, ok = configFieldForRef(fields, "not a pointer")
+	assert.False(t, ok)
+}
+
+type testFieldPathConf struct {
+	ExternalEndpoint struct {
+		LogLevel string
+		APIToken string `envconfig:"TOKEN"`
+	}
+	MaxRetries int
+}
+
+func TestCollectEnvConfigFields_FieldPathNaming(t *testing.T) {
+	fields, err := collectEnvConfigFields(&testFieldPathConf{}, "APP", FieldPathNaming)
+
+	assert.Nil(t, err)
+
+	got := [][]string{}
+	for _, f := range fields {
+		got = append(got, []string{f.Name(), f.EnvVar, f.EnvAlt})
+	}
+
+	assert.Equal(t, [][]string{
+		{"ExternalEndpoint.LogLevel", "APP_EXTERNAL_ENDPOINT_LOG_LEVEL", ""},
+		{"ExternalEndpoint.APIToken", "APP_EXTERNAL_ENDPOINT_TOKEN", "TOKEN"},
+		{"MaxRetries", "APP_MAX_RETRIES", ""},
+	}, got)
+}
+
+func TestSanitiseEnvPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"example", "EXAMPLE"},
+		{"my-tool", "MY_TOOL"},
+		{"my.tool--v2", "MY_TOOL_V2"},
+		{"-leading-", "LEADING"},
+		{"2fa", "_2FA"},
+		{"already_OK", "ALREADY_OK"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, sanitiseEnvPrefix(test.name))
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package clapp
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FlagPreParser is implemented by executors that don't use pflag's syntax for
+// flags. Run uses it to read the built in flags it needs before the command
+// tree is built, such as --config, the same way the executor will read them.
+type FlagPreParser interface {
+	// PreParseFlag returns every value given for f in args, in order. Bool
+	// flags given without a value are "true".
+	PreParseFlag(args []string, f Flag) []string
+}
+
+// pflagPreParser reads flags with pflag's syntax, as CobraExecutor does.
+type pflagPreParser struct{}
+
+func (pflagPreParser) PreParseFlag(args []string, f Flag) []string {
+	if f.Type == BoolFlag {
+		return preParseBoolValues(args, f.Name)
+	}
+
+	return preParseFlag(args, f.Name, f.Short)
+}
+
+// flagPreParser is how e reads flags, pflag's syntax unless e implements
+// FlagPreParser.
+func flagPreParser(e Executor) FlagPreParser {
+	if p, ok := e.(FlagPreParser); ok {
+		return p
+	}
+
+	return pflagPreParser{}
+}
+
+// preParseFlag finds every value given for a string flag before the command
+// tree is built. This lets values that are needed to load the config (which
+// happens before flags are parsed) be given on the command line.
+func preParseFlag(args []string, name string, short string) []string {
+	values := []string{}
+	prefixes := []string{"--" + name}
+
+	if short != "" {
+		prefixes = append(prefixes, "-"+short)
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// Everything after a bare -- is positional
+		if arg == "--" {
+			break
+		}
+
+		for _, p := range prefixes {
+			if arg == p {
+				if i+1 < len(args) {
+					values = append(values, args[i+1])
+					i++
+				}
+				break
+			}
+
+			if strings.HasPrefix(arg, p+"=") {
+				values = append(values, strings.TrimPrefix(arg, p+"="))
+				break
+			}
+
+			// shorthand values can be attached e.g. -cfoo.yaml
+			if p != "--"+name && strings.HasPrefix(arg, p) && !strings.HasPrefix(arg, "--") {
+				values = append(values, strings.TrimPrefix(arg, p))
+				break
+			}
+		}
+	}
+
+	return values
+}
+
+// flagInTree reports whether any command in the tree already defines a flag
+// with the given name or shorthand. Built in flags are skipped when this is
+// the case so they never clash with the app's own flags.
+func flagInTree(cmd Command, name string, short string) (nameUsed bool, shortUsed bool) {
+	for _, f := range append(append([]Flag{}, cmd.LocalFlags...), cmd.PersistentFlags...) {
+		if f.Name == name {
+			nameUsed = true
+		}
+
+		if short != "" && f.Short == short {
+			shortUsed = true
+		}
+	}
+
+	for _, c := range cmd.Children {
+		n, s := flagInTree(c, name, short)
+		nameUsed = nameUsed || n
+		shortUsed = shortUsed || s
+	}
+
+	return
+}
+
+// addBuiltinFlag adds a persistent flag to the root command, unless the
+// command tree already uses its name. The shorthand is dropped if that is
+// taken. It returns the flag as it was added and whether it was added.
+func addBuiltinFlag(root *Command, f Flag) (Flag, bool) {
+	nameUsed, shortUsed := flagInTree(*root, f.Name, f.Short)
+
+	if nameUsed {
+		return f, false
+	}
+
+	if shortUsed {
+		f.Short = ""
+	}
+
+	root.PersistentFlags = append(append([]Flag{}, root.PersistentFlags...), f)
+
+	return f, true
+}
+
+// applyFlag copies the parsed value of a flag that was given on the command
+// line to its ValueRef. Executors parse flags into separate storage so a value
+// loaded from the config file or env is only replaced when the flag is given.
+func applyFlag(ctx context.Context, ref interface{}, parsed interface{}) {
+	reflect.ValueOf(ref).Elem().Set(reflect.ValueOf(parsed).Elem())
+
+	if ctx == nil {
+		return
+	}
+
+	if c := ConfigManagerFromContext(ctx); c != nil {
+		c.flagRefs = append(c.flagRefs, ref)
+	}
+}
+
+// overrideWithFlags copies the fields of from that were set by a flag into the
+// same fields of into, both must be the same type.
+func (c *Config) overrideWithFlags(from interface{}, into interface{}) {
+	if c == nil || len(c.flagRefs) == 0 {
+		return
+	}
+
+	fields, err := collectConfigFields(from, "")
+
+	if err != nil {
+		return
+	}
+
+	for _, ref := range c.flagRefs {
+		if f, ok := configFieldForRef(fields, ref); ok {
+			setFieldByPath(reflect.ValueOf(into).Elem(), f.Path, deepCopyValue(f.Value))
+		}
+	}
+}
+
+// builtinValue returns a ValueRef holding the value the config field f is
+// bound to had before any source was loaded. fields are the config fields now
+// and defaults are the fields before loading.
+func builtinValue(f Flag, fields []configField, defaults []configField) (interface{}, bool) {
+	cf, bound := configFieldForRef(fields, f.ValueRef)
+
+	if !bound {
+		return nil, false
+	}
+
+	for _, d := range defaults {
+		if !d.Value.IsValid() || d.Name() != cf.Name() || d.Value.Type() != cf.Value.Type() {
+			continue
+		}
+
+		ref := reflect.New(d.Value.Type())
+		ref.Elem().Set(d.Value)
+
+		return ref.Interface(), true
+	}
+
+	return nil, false
+}
+
+// builtinDefault is builtinValue for help, which only shows the built in
+// default when the config file or env has changed it. Secrets are never
+// described.
+func builtinDefault(f Flag, fields []configField, defaults []configField) (interface{}, bool) {
+	cf, bound := configFieldForRef(fields, f.ValueRef)
+
+	if !bound || f.Secret || cf.Secret() {
+		return nil, false
+	}
+
+	ref, ok := builtinValue(f, fields, defaults)
+
+	if !ok || flagDefault(ref) == flagDefault(f.ValueRef) {
+		return nil, false
+	}
+
+	return ref, true
+}
+
+// preParseBoolFlag reports whether a bool flag was given as true before the
+// command tree is built, the last value given wins.
+func preParseBoolFlag(p FlagPreParser, args []string, f Flag) bool {
+	vals := p.PreParseFlag(args, f)
+
+	if len(vals) == 0 {
+		return false
+	}
+
+	v, err := strconv.ParseBool(vals[len(vals)-1])
+
+	return err == nil && v
+}
+
+// preParseBoolValues finds every value given for a bool flag with pflag's
+// syntax.
+func preParseBoolValues(args []string, name string) []string {
+	values := []string{}
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if arg == "--"+name {
+			values = append(values, "true")
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			values = append(values, strings.TrimPrefix(arg, "--"+name+"="))
+		}
+	}
+
+	return values
+}
+
+// CheckValueRef returns ErrIncorrectValueRefForFlag when the ValueRef isn't a
+// pointer to the type of the flag, or ErrFlagTypeNotImplemented when the type
+// is unknown.
+func (f Flag) CheckValueRef() error {
+	var ok bool
+	var expected string
+
+	switch f.Type {
+	case StringFlag:
+		_, ok = f.ValueRef.(*string)
+		expected = "string"
+	case StringSliceFlag:
+		_, ok = f.ValueRef.(*[]string)
+		expected = "[]string"
+	case IntFlag:
+		_, ok = f.ValueRef.(*int)
+		expected = "int"
+	case IntSliceFlag:
+		_, ok = f.ValueRef.(*[]int)
+		expected = "[]int"
+	case BoolFlag:
+		_, ok = f.ValueRef.(*bool)
+		expected = "bool"
+	default:
+		return ErrFlagTypeNotImplemented{
+			t: string(f.Type),
+		}
+	}
+
+	if !ok {
+		return ErrIncorrectValueRefForFlag{
+			expectedType: expected,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package clapp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreParseFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "no args",
+			args:     []string{},
+			expected: []string{},
+		},
+		{
+			name:     "separate value",
+			args:     []string{"child", "--profile", "prod"},
+			expected: []string{"prod"},
+		},
+		{
+			name:     "equals value",
+			args:     []string{"--profile=prod", "child"},
+			expected: []string{"prod"},
+		},
+		{
+			name:     "shorthand values",
+			args:     []string{"-p", "prod", "-p=dev", "-pstaging"},
+			expected: []string{"prod", "dev", "staging"},
+		},
+		{
+			name:     "similar flags are ignored",
+			args:     []string{"--profiles", "prod", "--profile-x=dev"},
+			expected: []string{},
+		},
+		{
+			name:     "values after -- are ignored",
+			args:     []string{"--profile", "prod", "--", "--profile", "dev"},
+			expected: []string{"prod"},
+		},
+		{
+			name:     "missing value is ignored",
+			args:     []string{"--profile"},
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, preParseFlag(test.args, "profile", "p"))
+		})
+	}
+}
+
+func TestPreParseBoolFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected bool
+	}{
+		{
+			name:     "not given",
+			args:     []string{"child", "--versions"},
+			expected: false,
+		},
+		{
+			name:     "given",
+			args:     []string{"child", "--version"},
+			expected: true,
+		},
+		{
+			name:     "given with a value",
+			args:     []string{"--version=true"},
+			expected: true,
+		},
+		{
+			name:     "given as false",
+			args:     []string{"--version", "--version=false"},
+			expected: false,
+		},
+		{
+			name:     "after a bare --",
+			args:     []string{"--", "--version"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, preParseBoolFlag(pflagPreParser{}, test.args, Flag{Name: "version", Type: BoolFlag}))
+		})
+	}
+}
+
+func TestAddBuiltinFlag(t *testing.T) {
+	root := Command{
+		Name: "root",
+		LocalFlags: []Flag{
+			{Name: "verbose", Short: "v"},
+		},
+		Children: []Command{
+			{
+				Name: "child",
+				LocalFlags: []Flag{
+					{Name: "config", Short: "x"},
+					{Name: "other", Short: "c"},
+				},
+			},
+		},
+	}
+
+	f, added := addBuiltinFlag(&root, Flag{Name: "config", Short: "c"})
+	assert.False(t, added)
+	assert.Equal(t, "c", f.Short)
+	assert.Len(t, root.PersistentFlags, 0)
+
+	f, added = addBuiltinFlag(&root, Flag{Name: "profile", Short: "c"})
+	assert.True(t, added)
+	assert.Equal(t, "", f.Short)
+	assert.Equal(t, []Flag{{Name: "profile"}}, root.PersistentFlags)
+
+	f, added = addBuiltinFlag(&root, Flag{Name: "output", Short: "o"})
+	assert.True(t, added)
+	assert.Equal(t, "o", f.Short)
+	assert.Len(t, root.PersistentFlags, 2)
+}
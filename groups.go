@@ -0,0 +1,202 @@
+package clapp
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+const commandGroupAnnotation string = "clapp_group"
+const commandGroupsAnnotation string = "clapp_groups"
+
+// groupedUsageTemplate is cobra's usage template with the children listed
+// under the titles of their groups.
+const groupedUsageTemplate string = `Usage:{{if .Runnable}}
+  {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
+  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+
+Aliases:
+  {{.NameAndAliases}}{{end}}{{if .HasExample}}
+
+Examples:
+{{.Example}}{{end}}{{if .HasAvailableSubCommands}}{{range clappCommandSections .}}
+
+{{.Title}}:{{range .Commands}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
+
+Flags:
+{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+
+Global Flags:
+{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+
+Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+
+Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
+`
+
+// usageFuncs are the functions cobra gives usage templates, along with
+// clappCommandSections. They are given to the template by groupedUsage rather
+// than added to cobra's global functions.
+var usageFuncs = template.FuncMap{
+	"trim":                    strings.TrimSpace,
+	"trimRightSpace":          trimRightSpace,
+	"trimTrailingWhitespaces": trimRightSpace,
+	"rpad":                    rpad,
+	"gt":                      cobra.Gt,
+	"eq":                      cobra.Eq,
+	"clappCommandSections":    commandSections,
+}
+
+func trimRightSpace(s string) string {
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+func rpad(s string, padding int) string {
+	return fmt.Sprintf("%-*s", padding, s)
+}
+
+// groupedUsage writes the usage of c as cobra does, but with usageFuncs so
+// the template can list commands by group. A template set by
+// CustomConfiguration is still used.
+func groupedUsage(c *cobra.Command) error {
+	tmpl, err := template.New("usage").Funcs(usageFuncs).Parse(c.UsageTemplate())
+
+	if err == nil {
+		err = tmpl.Execute(c.OutOrStderr(), c)
+	}
+
+	if err != nil {
+		c.PrintErrln(err)
+	}
+
+	return err
+}
+
+// commandSection is a heading in help and the commands listed under it.
+type commandSection struct {
+	Title    string
+	Commands []*cobra.Command
+}
+
+func commandGroups(c *cobra.Command) []CommandGroup {
+	groups := []CommandGroup{}
+
+	for _, line := range strings.Split(c.Annotations[commandGroupsAnnotation], "\n") {
+		if parts := strings.SplitN(line, "\t", 2); len(parts) == 2 {
+			groups = append(groups, CommandGroup{
+				ID:    parts[0],
+				Title: parts[1],
+			})
+		}
+	}
+
+	return groups
+}
+
+// commandSections lists the children of c that are shown in help, under the
+// titles of the groups they are in.
+func commandSections(c *cobra.Command) []commandSection {
+	groups := commandGroups(c)
+	sections := []commandSection{}
+	byID := map[string]int{}
+
+	for _, g := range groups {
+		byID[g.ID] = len(sections)
+		sections = append(sections, commandSection{
+			Title: g.Title,
+		})
+	}
+
+	other := commandSection{
+		Title: "Available Commands",
+	}
+
+	if len(groups) > 0 {
+		other.Title = "Additional Commands"
+	}
+
+	for _, child := range c.Commands() {
+		if (child.Hidden || child.Deprecated != "") && child.Name() != "help" {
+			continue
+		}
+
+		if i, ok := byID[child.Annotations[commandGroupAnnotation]]; ok {
+			sections[i].Commands = append(sections[i].Commands, child)
+			continue
+		}
+
+		other.Commands = append(other.Commands, child)
+	}
+
+	visible := []commandSection{}
+
+	for _, s := range append(sections, other) {
+		if len(s.Commands) > 0 {
+			visible = append(visible, s)
+		}
+	}
+
+	return visible
+}
+
+// configureCommand copies the details of cmd that cobra shows in help to c.
+func configureCommand(c *cobra.Command, cmd Command) {
+	c.Aliases = cmd.Aliases
+	c.Hidden = cmd.Hidden
+	c.Deprecated = cmd.Deprecated
+	c.Example = cmd.Example
+
+	if cmd.Group != "" {
+		setAnnotation(c, commandGroupAnnotation, cmd.Group)
+	}
+
+	if len(cmd.Groups) == 0 {
+		return
+	}
+
+	lines := []string{}
+	for _, g := range cmd.Groups {
+		lines = append(lines, fmt.Sprintf("%s\t%s", g.ID, g.Title))
+	}
+
+	setAnnotation(c, commandGroupsAnnotation, strings.Join(lines, "\n"))
+	c.SetUsageTemplate(groupedUsageTemplate)
+	c.SetUsageFunc(groupedUsage)
+}
+
+func setAnnotation(c *cobra.Command, key string, value string) {
+	if c.Annotations == nil {
+		c.Annotations = map[string]string{}
+	}
+
+	c.Annotations[key] = value
+}
+
+// checkCommandGroups makes sure every command's Group is one of its parent's
+// Groups.
+func checkCommandGroups(cmd Command) error {
+	ids := map[string]bool{}
+	for _, g := range cmd.Groups {
+		ids[g.ID] = true
+	}
+
+	for _, child := range cmd.Children {
+		if child.Group != "" && !ids[child.Group] {
+			return ErrUnknownCommandGroup{
+				Command: child.Name,
+				Group:   child.Group,
+			}
+		}
+
+		if err := checkCommandGroups(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package clapp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandSections(t *testing.T) {
+	names := func(sections []commandSection) map[string][]string {
+		m := map[string][]string{}
+
+		for _, s := range sections {
+			for _, c := range s.Commands {
+				m[s.Title] = append(m[s.Title], c.Name())
+			}
+		}
+
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		cmd      Command
+		expected map[string][]string
+	}{
+		{
+			name: "no groups",
+			cmd: Command{
+				Name: "root",
+				Children: []Command{
+					{Name: "a"},
+					{Name: "b", Hidden: true},
+					{Name: "c", Deprecated: "gone"},
+				},
+			},
+			expected: map[string][]string{
+				"Available Commands": {"a"},
+			},
+		},
+		{
+			name: "grouped and ungrouped",
+			cmd: Command{
+				Name: "root",
+				Groups: []CommandGroup{
+					{ID: "one", Title: "First"},
+					{ID: "two", Title: "Second"},
+					{ID: "empty", Title: "Empty"},
+				},
+				Children: []Command{
+					{Name: "a", Group: "two"},
+					{Name: "b", Group: "one"},
+					{Name: "c"},
+					{Name: "d", Group: "one"},
+				},
+			},
+			expected: map[string][]string{
+				"First":               {"b", "d"},
+				"Second":              {"a"},
+				"Additional Commands": {"c"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			built, err := newCobraBuilder().Build(test.cmd, &testConf{})
+			assert.Nil(tt, err)
+
+			assert.Equal(tt, test.expected, names(commandSections(built.(*cobra.Command))))
+		})
+	}
+}
+
+func TestCommandSections_Order(t *testing.T) {
+	built, err := newCobraBuilder().Build(Command{
+		Name: "root",
+		Groups: []CommandGroup{
+			{ID: "two", Title: "Second"},
+			{ID: "one", Title: "First"},
+		},
+		Children: []Command{
+			{Name: "a", Group: "one"},
+			{Name: "b", Group: "two"},
+		},
+	}, &testConf{})
+	assert.Nil(t, err)
+
+	titles := []string{}
+	for _, s := range commandSections(built.(*cobra.Command)) {
+		titles = append(titles, s.Title)
+	}
+
+	assert.Equal(t, []string{"Second", "First"}, titles)
+}
+
+func TestGroupedUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		custom   func(c *cobra.Command)
+		expected string
+	}{
+		{
+			name:     "lists commands by group",
+			expected: "Usage:\n  root\n  root [command]\n\nFirst:\n  a           \n\nAdditional Commands:\n  b           \n  help        Help about any command\n\nUse \"root [command] --help\" for more information about a command.\n",
+		},
+		{
+			name: "uses the template from CustomConfiguration",
+			custom: func(c *cobra.Command) {
+				c.SetUsageTemplate(`custom {{rpad .Name 6}}|{{range clappCommandSections .}}{{.Title}},{{end}}`)
+			},
+			expected: "custom root  |First,Additional Commands,",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+
+			built, err := newCobraBuilder().Build(Command{
+				Name: "root",
+				Groups: []CommandGroup{
+					{ID: "one", Title: "First"},
+				},
+				Children: []Command{
+					{Name: "a", Group: "one", Handle: func(*cobra.Command, []string) error { return nil }},
+					{Name: "b", Handle: func(*cobra.Command, []string) error { return nil }},
+				},
+				CustomConfiguration: test.custom,
+			}, &testConf{})
+			assert.Nil(tt, err)
+
+			c := built.(*cobra.Command)
+			c.InitDefaultHelpCmd()
+			c.SetOut(out)
+
+			assert.Nil(tt, c.Usage())
+			assert.Equal(tt, test.expected, out.String())
+		})
+	}
+}
+
+func TestRun_FailsForUnknownCommandGroup(t *testing.T) {
+	err := Run(App{
+		Config:  &testConf{},
+		Fs:      afero.NewMemMapFs(),
+		Args:    []string{},
+		Environ: Environ{},
+		RootCommand: Command{
+			Name: "root",
+			Children: []Command{
+				{
+					Name: "child",
+					Groups: []CommandGroup{
+						{ID: "one", Title: "First"},
+					},
+					Children: []Command{
+						{Name: "grandchild", Group: "two"},
+					},
+				},
+			},
+		},
+	}, NewCobraExecutor())
+
+	assert.Equal(t, ErrUnknownCommandGroup{Command: "grandchild", Group: "two"}, err)
+}
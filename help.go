@@ -0,0 +1,595 @@
+package clapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const HelpRendererContextKey ContextKey = "HELP_RENDERER"
+
+const defaultHelpWidth int = 80
+
+// minHelpWrap stops descriptions being squeezed into a narrow column when the
+// flags are long or the terminal is small.
+const minHelpWrap int = 20
+
+// DefaultHelpTemplate is executed with a HelpData when HelpOptions.Template
+// is empty. Along with the text/template builtins, templates can use:
+//
+//	heading "Title"          the title in bold when colour is on
+//	wrap 2 .Long             text wrapped to the width, indented on new lines
+//	commandTable .Commands   children aligned with their short descriptions
+//	flagTable .Flags         flags aligned with their descriptions, defaults,
+//	                         env vars and config keys
+//	join .Aliases ", "       strings.Join
+const DefaultHelpTemplate string = `{{with or .Long .Short}}{{wrap 0 .}}
+
+{{end}}{{with .Deprecated}}{{heading "Deprecated:"}} {{wrap 12 .}}
+
+{{end}}{{heading "Usage:"}}{{if .Runnable}}
+  {{.Path}} [flags]{{end}}{{if .Sections}}
+  {{.Path}} [command]{{end}}{{if .Aliases}}
+
+{{heading "Aliases:"}}
+  {{.Name}}, {{join .Aliases ", "}}{{end}}{{if .Example}}
+
+{{heading "Examples:"}}
+{{.Example}}{{end}}{{range .Sections}}
+
+{{heading (printf "%s:" .Title)}}
+{{commandTable .Commands}}{{end}}{{if .Flags}}
+
+{{heading "Flags:"}}
+{{flagTable .Flags}}{{end}}{{if .InheritedFlags}}
+
+{{heading "Global Flags:"}}
+{{flagTable .InheritedFlags}}{{end}}{{if .Sections}}
+
+Use "{{.Path}} [command] --help" for more information about a command.{{end}}`
+
+type HelpOptions struct {
+	// Template replaces DefaultHelpTemplate, it is executed with a HelpData
+	Template string
+
+	// Width is the column help is wrapped at. When it is 0 $COLUMNS is used,
+	// then the width of the terminal help is written to, then 80
+	Width int
+
+	// Color shows headings in bold and flags in cyan when help is written to
+	// a terminal, unless NO_COLOR is set
+	Color bool
+
+	// HelpAll adds a --help-all flag to the root command which shows help
+	// for the command and everything below it
+	HelpAll bool
+}
+
+// HelpData is what the help template is executed with.
+type HelpData struct {
+	Name       string
+	Path       string
+	Short      string
+	Long       string
+	Example    string
+	Deprecated string
+	Aliases    []string
+
+	// Runnable is true when the command has a handler, or no children
+	Runnable bool
+
+	Sections       []HelpSection
+	Flags          []FlagDoc
+	InheritedFlags []FlagDoc
+}
+
+// HelpSection is a heading in help and the commands listed under it.
+type HelpSection struct {
+	Title    string
+	Commands []HelpCommand
+}
+
+type HelpCommand struct {
+	Name  string
+	Short string
+}
+
+// helpRenderer writes help for the commands in a tree, executors use it in
+// place of their own help when App.Help is set.
+type helpRenderer struct {
+	root   Command
+	fields []configField
+
+	// defaults are the config fields before any source was loaded
+	defaults []configField
+
+	tmpl  *template.Template
+	width int
+	color bool
+
+	// sources shows the env var and config key of flags bound to the config
+	sources bool
+}
+
+// newHelpRenderer creates a renderer for help written to out, which is used to
+// find the width of the terminal and whether colour can be shown.
+func newHelpRenderer(o HelpOptions, root Command, fields []configField, defaults []configField, lookupEnv func(string) (string, bool), out io.Writer) (*helpRenderer, error) {
+	termWidth, isTerm := terminalWidth(out)
+
+	h := &helpRenderer{
+		root:     root,
+		fields:   fields,
+		defaults: defaults,
+		width:    o.Width,
+		color:    o.Color && isTerm && !noColor(lookupEnv),
+		sources:  true,
+	}
+
+	if h.width <= 0 {
+		h.width = defaultHelpWidth
+
+		if termWidth > 0 {
+			h.width = termWidth
+		}
+
+		if v, ok := lookupEnv("COLUMNS"); ok {
+			if cols, err := strconv.Atoi(v); err == nil && cols > 0 {
+				h.width = cols
+			}
+		}
+	}
+
+	text := o.Template
+	if text == "" {
+		text = DefaultHelpTemplate
+	}
+
+	tmpl, err := template.New("help").Funcs(template.FuncMap{
+		"heading":      h.heading,
+		"wrap":         h.wrap,
+		"commandTable": h.commandTable,
+		"flagTable":    h.flagTable,
+		"join":         strings.Join,
+	}).Parse(text)
+
+	if err != nil {
+		return nil, ErrInvalidHelpTemplate{
+			wrapped: err,
+		}
+	}
+
+	h.tmpl = tmpl
+
+	return h, nil
+}
+
+func contextWithHelpRenderer(ctx context.Context, h *helpRenderer) context.Context {
+	return context.WithValue(
+		ctx,
+		HelpRendererContextKey,
+		h,
+	)
+}
+
+func helpRendererFromContext(ctx context.Context) *helpRenderer {
+	if ctx == nil {
+		return nil
+	}
+
+	h, _ := ctx.Value(HelpRendererContextKey).(*helpRenderer)
+
+	return h
+}
+
+// find walks path, the names or aliases of the commands below the root, and
+// returns the command it leads to along with its full path and the persistent
+// flags of its parents.
+func (h *helpRenderer) find(path []string) (Command, string, []Flag, bool) {
+	cmd := h.root
+	full := cmd.Name
+	inherited := []Flag{}
+
+	for _, name := range path {
+		inherited = append(inherited, cmd.PersistentFlags...)
+		child, ok := childNamed(cmd, name)
+
+		if !ok {
+			return Command{}, "", nil, false
+		}
+
+		cmd = child
+		full = fmt.Sprintf("%s %s", full, cmd.Name)
+	}
+
+	return cmd, full, inherited, true
+}
+
+func childNamed(cmd Command, name string) (Command, bool) {
+	for _, c := range cmd.Children {
+		if c.Name == name {
+			return c, true
+		}
+
+		for _, a := range c.Aliases {
+			if a == name {
+				return c, true
+			}
+		}
+	}
+
+	return Command{}, false
+}
+
+func (h *helpRenderer) data(cmd Command, path string, inherited []Flag) HelpData {
+	return HelpData{
+		Name:           cmd.Name,
+		Path:           path,
+		Short:          cmd.Descriptions.Short,
+		Long:           cmd.Descriptions.Long,
+		Example:        strings.TrimRight(cmd.Example, "\n"),
+		Deprecated:     cmd.Deprecated,
+		Aliases:        cmd.Aliases,
+		Runnable:       cmd.Handle != nil || len(cmd.Children) == 0,
+		Sections:       helpSections(cmd),
+		Flags:          h.flagDocs(append(append([]Flag{}, cmd.LocalFlags...), cmd.PersistentFlags...)),
+		InheritedFlags: h.flagDocs(inherited),
+	}
+}
+
+// flagDocs describes flags sorted by name, leaving out zero defaults and
+// adding the built in default to the description as cobra does.
+func (h *helpRenderer) flagDocs(flags []Flag) []FlagDoc {
+	docs := buildFlagDocs(flags, h.fields, nil)
+
+	for i, d := range docs {
+		if ref, changed := builtinDefault(flags[i], h.fields, h.defaults); changed {
+			def := helpDefault(FlagDoc{Type: d.Type, Default: flagDefault(ref)})
+			docs[i].Description += fmt.Sprintf(" (built-in default %s)", def)
+		}
+
+		if d.Default == "0" && d.Type == string(IntFlag) || d.Default == "false" && d.Type == string(BoolFlag) {
+			docs[i].Default = ""
+		}
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Name < docs[j].Name
+	})
+
+	return docs
+}
+
+// helpSections lists the children of cmd that are shown in help under the
+// titles of their groups, as commandSections does for cobra commands.
+func helpSections(cmd Command) []HelpSection {
+	sections := []HelpSection{}
+	byID := map[string]int{}
+
+	for _, g := range cmd.Groups {
+		byID[g.ID] = len(sections)
+		sections = append(sections, HelpSection{
+			Title: g.Title,
+		})
+	}
+
+	other := HelpSection{
+		Title: "Available Commands",
+	}
+
+	if len(cmd.Groups) > 0 {
+		other.Title = "Additional Commands"
+	}
+
+	for _, child := range cmd.Children {
+		if child.Hidden || child.Deprecated != "" {
+			continue
+		}
+
+		hc := HelpCommand{
+			Name:  child.Name,
+			Short: child.Descriptions.Short,
+		}
+
+		if i, ok := byID[child.Group]; ok {
+			sections[i].Commands = append(sections[i].Commands, hc)
+			continue
+		}
+
+		other.Commands = append(other.Commands, hc)
+	}
+
+	visible := []HelpSection{}
+
+	for _, s := range append(sections, other) {
+		if len(s.Commands) > 0 {
+			visible = append(visible, s)
+		}
+	}
+
+	return visible
+}
+
+// render writes help for the command at path, it reports false when there
+// is no such command.
+func (h *helpRenderer) render(w io.Writer, path []string) (bool, error) {
+	cmd, full, inherited, ok := h.find(path)
+
+	if !ok {
+		return false, nil
+	}
+
+	return true, h.write(w, h.data(cmd, full, inherited))
+}
+
+// renderAll writes help for the command at path and every command below it
+// that is shown in help, leaving out hidden and deprecated commands.
+func (h *helpRenderer) renderAll(w io.Writer, path []string) error {
+	cmd, full, inherited, ok := h.find(path)
+
+	if !ok {
+		return ErrUnknownCommand{
+			Name:   strings.Join(path, " "),
+			Parent: h.root.Name,
+		}
+	}
+
+	first := true
+
+	var visit func(cmd Command, full string, inherited []Flag) error
+	visit = func(cmd Command, full string, inherited []Flag) error {
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+
+		first = false
+
+		if err := h.write(w, h.data(cmd, full, inherited)); err != nil {
+			return err
+		}
+
+		childInherited := append(append([]Flag{}, inherited...), cmd.PersistentFlags...)
+
+		for _, c := range cmd.Children {
+			if c.Hidden || c.Deprecated != "" {
+				continue
+			}
+
+			if err := visit(c, fmt.Sprintf("%s %s", full, c.Name), childInherited); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return visit(cmd, full, inherited)
+}
+
+func (h *helpRenderer) write(w io.Writer, d HelpData) error {
+	var b bytes.Buffer
+
+	if err := h.tmpl.Execute(&b, d); err != nil {
+		return ErrInvalidHelpTemplate{
+			wrapped: err,
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n", strings.TrimRight(b.String(), "\n"))
+
+	return err
+}
+
+func (h *helpRenderer) heading(s string) string {
+	if !h.color {
+		return s
+	}
+
+	return "\x1b[1m" + s + "\x1b[0m"
+}
+
+func (h *helpRenderer) flagName(s string) string {
+	if !h.color {
+		return s
+	}
+
+	return "\x1b[36m" + s + "\x1b[0m"
+}
+
+// wrap breaks text into lines that fit the width, lines after the first are
+// indented so they line up with text starting at column indent. Lines that
+// start with whitespace are kept as they are, so indented text such as
+// examples or lists isn't reflowed.
+func (h *helpRenderer) wrap(indent int, text string) string {
+	limit := h.width - indent
+	if limit < minHelpWrap {
+		limit = minHelpWrap
+	}
+
+	pad := "\n" + strings.Repeat(" ", indent)
+	lines := []string{}
+
+	for _, para := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.TrimLeft(para, " \t") != para {
+			lines = append(lines, strings.TrimRight(para, " \t"))
+			continue
+		}
+
+		line := ""
+
+		for _, word := range strings.Fields(para) {
+			if line != "" && len(line)+1+len(word) > limit {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+
+			if line != "" {
+				line += " "
+			}
+
+			line += word
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, pad)
+}
+
+func (h *helpRenderer) commandTable(cmds []HelpCommand) string {
+	width := 0
+	for _, c := range cmds {
+		if len(c.Name) > width {
+			width = len(c.Name)
+		}
+	}
+
+	col := width + 5
+	lines := []string{}
+
+	for _, c := range cmds {
+		line := fmt.Sprintf("  %-*s   %s", width, c.Name, h.wrap(col, c.Short))
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// flagTable lists flags in the same layout as pflag, with the env var and
+// config key of flags bound to the config on the line below.
+func (h *helpRenderer) flagTable(flags []FlagDoc) string {
+	names := []string{}
+	width := 0
+
+	for _, f := range flags {
+		name := "      --" + f.Name
+		if f.Short != "" {
+			name = fmt.Sprintf("  -%s, --%s", f.Short, f.Name)
+		}
+
+		if t := flagTypeName(ValueType(f.Type)); t != "" {
+			name += " " + t
+		}
+
+		if len(name) > width {
+			width = len(name)
+		}
+
+		names = append(names, name)
+	}
+
+	col := width + 3
+	pad := strings.Repeat(" ", col)
+	lines := []string{}
+
+	for i, f := range flags {
+		desc := f.Description
+
+		if f.Default != "" {
+			desc += fmt.Sprintf(" (default %s)", helpDefault(f))
+		}
+
+		if f.Required {
+			desc += " (required)"
+		}
+
+		line := h.flagName(names[i]) + strings.Repeat(" ", col-len(names[i])) + h.wrap(col, desc)
+		lines = append(lines, strings.TrimRight(line, " "))
+
+		if !h.sources {
+			continue
+		}
+
+		sources := []string{}
+
+		if f.EnvVar != "" {
+			sources = append(sources, "env: "+f.EnvVar)
+		}
+
+		if f.ConfigKey != "" {
+			sources = append(sources, "config: "+f.ConfigKey)
+		}
+
+		if len(sources) > 0 {
+			lines = append(lines, pad+h.wrap(col, fmt.Sprintf("[%s]", strings.Join(sources, ", "))))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// flagTypeName is the name pflag shows for the type of a flag's value.
+func flagTypeName(t ValueType) string {
+	switch t {
+	case StringSliceFlag:
+		return "strings"
+	case IntSliceFlag:
+		return "ints"
+	case BoolFlag:
+		return ""
+	}
+
+	return string(t)
+}
+
+func helpDefault(f FlagDoc) string {
+	switch ValueType(f.Type) {
+	case StringFlag:
+		if f.Default == SecretMask {
+			return f.Default
+		}
+
+		return strconv.Quote(f.Default)
+	case StringSliceFlag, IntSliceFlag:
+		return fmt.Sprintf("[%s]", f.Default)
+	}
+
+	return f.Default
+}
+
+// helpAllPath finds the command --help-all was given for, by following the
+// args that name children. Other args are skipped, as they may be the values
+// of flags.
+func helpAllPath(root Command, args []string) []string {
+	path := []string{}
+	cmd := root
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		if child, ok := childNamed(cmd, arg); ok {
+			path = append(path, arg)
+			cmd = child
+		}
+	}
+
+	return path
+}
+
+// builtinHelpAll adds the --help-all flag to the root command and reports
+// whether it was given.
+func builtinHelpAll(root *Command, args []string, pre FlagPreParser) bool {
+	var helpAll bool
+
+	f, added := addBuiltinFlag(root, Flag{
+		Name:        "help-all",
+		Description: "Show help for the command and all commands below it",
+		ValueRef:    &helpAll,
+		Type:        BoolFlag,
+	})
+
+	return added && preParseBoolFlag(pre, args, f)
+}
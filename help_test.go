@@ -0,0 +1,367 @@
+package clapp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHelpConf struct {
+	Region  string   `yaml:"region" envconfig:"REGION"`
+	Retries int      `yaml:"retries"`
+	Tags    []string `yaml:"tags"`
+}
+
+func helpApp(cfg *testHelpConf, opts *HelpOptions, args []string, out *bytes.Buffer) App {
+	var verbose bool
+	var name string
+
+	noop := func(cmd *cobra.Command, args []string) error {
+		return nil
+	}
+
+	return App{
+		Config:  cfg,
+		Fs:      afero.NewMemMapFs(),
+		Args:    args,
+		Environ: Environ{},
+		Stdout:  out,
+		Stderr:  out,
+		Help:    opts,
+		RootCommand: Command{
+			Name: "helper",
+			Descriptions: Descriptions{
+				Short: "Helps with things",
+			},
+			Groups: []CommandGroup{
+				{ID: "main", Title: "Main Commands"},
+			},
+			PersistentFlags: []Flag{
+				{
+					Name:        "region",
+					Short:       "r",
+					Description: "The region to use",
+					ValueRef:    &cfg.Region,
+					Type:        StringFlag,
+				},
+				{
+					Name:        "verbose",
+					Short:       "v",
+					Description: "Log more",
+					ValueRef:    &verbose,
+					Type:        BoolFlag,
+				},
+			},
+			Handle: noop,
+			Children: []Command{
+				{
+					Name:    "deploy",
+					Aliases: []string{"d"},
+					Group:   "main",
+					Descriptions: Descriptions{
+						Short: "Deploy the app",
+						Long:  "Deploy the app to every region that has been configured, waiting for each one to finish before moving on to the next",
+					},
+					Example: "  helper deploy --name web",
+					LocalFlags: []Flag{
+						{
+							Name:        "name",
+							Description: "The name of the deployment",
+							ValueRef:    &name,
+							Type:        StringFlag,
+							Required:    true,
+						},
+						{
+							Name:        "tags",
+							Description: "Tags for the deployment",
+							ValueRef:    &cfg.Tags,
+							Type:        StringSliceFlag,
+						},
+					},
+					Handle: noop,
+					Children: []Command{
+						{
+							Name: "status",
+							Descriptions: Descriptions{
+								Short: "Show the status of a deployment",
+							},
+							Handle: noop,
+						},
+					},
+				},
+				{
+					Name: "retry",
+					Descriptions: Descriptions{
+						Short: "Retry the last deployment",
+					},
+					LocalFlags: []Flag{
+						{
+							Name:        "retries",
+							Description: "How many times to retry",
+							ValueRef:    &cfg.Retries,
+							Type:        IntFlag,
+						},
+					},
+					Handle: noop,
+				},
+				{
+					Name:   "secret",
+					Hidden: true,
+					Handle: noop,
+				},
+				{
+					Name:       "old",
+					Deprecated: "use deploy instead",
+					Handle:     noop,
+				},
+			},
+		},
+	}
+}
+
+const expectedRootHelp string = `Helps with things
+
+Usage:
+  helper [flags]
+  helper [command]
+
+Main Commands:
+  deploy   Deploy the app
+
+Additional Commands:
+  retry   Retry the last deployment
+
+Flags:
+  -c, --config strings   Config file to load, repeat to layer files (env:
+                         HELPER_CONFIG)
+      --profile string   Overlay <name>.<profile>.yaml on the config file (env:
+                         HELPER_PROFILE)
+  -r, --region string    The region to use (default "eu")
+                         [env: HELPER_REGION, config: region]
+  -v, --verbose          Log more
+
+Use "helper [command] --help" for more information about a command.
+`
+
+const expectedDeployHelp string = `Deploy the app to every region that has been
+configured, waiting for each one to finish before
+moving on to the next
+
+Usage:
+  helper deploy [flags]
+  helper deploy [command]
+
+Aliases:
+  deploy, d
+
+Examples:
+  helper deploy --name web
+
+Available Commands:
+  status   Show the status of a deployment
+
+Flags:
+      --name string    The name of the deployment
+                       (required)
+      --tags strings   Tags for the deployment
+                       (default [a,b])
+                       [env: HELPER_TAGS, config:
+                       tags]
+
+Global Flags:
+  -c, --config strings   Config file to load,
+                         repeat to layer files
+                         (env: HELPER_CONFIG)
+      --profile string   Overlay
+                         <name>.<profile>.yaml on
+                         the config file (env:
+                         HELPER_PROFILE)
+  -r, --region string    The region to use
+                         (default "eu")
+                         [env: HELPER_REGION,
+                         config: region]
+  -v, --verbose          Log more
+
+Use "helper deploy [command] --help" for more information about a command.
+`
+
+func TestRun_Help(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		opts     HelpOptions
+		expected string
+	}{
+		{
+			name:     "root help",
+			args:     []string{"--help"},
+			expected: expectedRootHelp,
+		},
+		{
+			name: "wrapped at the width",
+			args: []string{"deploy", "--help"},
+			opts: HelpOptions{
+				Width: 50,
+			},
+			expected: expectedDeployHelp,
+		},
+		{
+			name: "help command",
+			args: []string{"help", "deploy"},
+			opts: HelpOptions{
+				Width: 50,
+			},
+			expected: expectedDeployHelp,
+		},
+		{
+			name: "custom template",
+			args: []string{"retry", "-h"},
+			opts: HelpOptions{
+				Template: `{{.Path}}: {{.Short}}{{range .Flags}} --{{.Name}}={{.Default}}{{end}}`,
+			},
+			expected: "helper retry: Retry the last deployment --retries=3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			cfg := &testHelpConf{
+				Region:  "eu",
+				Retries: 3,
+				Tags:    []string{"a", "b"},
+			}
+			opts := test.opts
+
+			err := Run(helpApp(cfg, &opts, test.args, out), NewCobraExecutor())
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, out.String())
+		})
+	}
+}
+
+func TestRun_HelpAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+		excluded []string
+	}{
+		{
+			name: "whole tree",
+			args: []string{"--help-all"},
+			expected: []string{
+				"helper [command]",
+				"helper deploy [command]",
+				"helper deploy status [flags]",
+				"helper retry [flags]",
+			},
+			excluded: []string{"helper secret", "helper old"},
+		},
+		{
+			name: "subtree",
+			args: []string{"--region", "us", "deploy", "--help-all"},
+			expected: []string{
+				"helper deploy [command]",
+				"helper deploy status [flags]",
+			},
+			excluded: []string{"helper retry", "helper [command]"},
+		},
+		{
+			name: "aliases",
+			args: []string{"d", "--help-all"},
+			expected: []string{
+				"helper deploy status [flags]",
+			},
+			excluded: []string{"helper retry"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+
+			err := Run(helpApp(&testHelpConf{}, &HelpOptions{HelpAll: true}, test.args, out), NewCobraExecutor())
+
+			assert.Nil(tt, err)
+
+			for _, s := range test.expected {
+				assert.Contains(tt, out.String(), s)
+			}
+
+			for _, s := range test.excluded {
+				assert.NotContains(tt, out.String(), s)
+			}
+		})
+	}
+
+	out := &bytes.Buffer{}
+	err := Run(helpApp(&testHelpConf{}, &HelpOptions{}, []string{"--help"}, out), NewCobraExecutor())
+
+	assert.Nil(t, err)
+	assert.NotContains(t, out.String(), "--help-all", "only added when HelpAll is set")
+}
+
+func TestRun_HelpKeepsIndentedText(t *testing.T) {
+	long := `Deploys the app, to every region that has been configured, one after the other
+waiting for each to finish.
+
+Regions:
+	eu      europe
+	us      north america
+
+    helper deploy --name web   # deploys web`
+
+	out := &bytes.Buffer{}
+	a := helpApp(&testHelpConf{}, &HelpOptions{Width: 50}, []string{"deploy", "--help"}, out)
+	a.RootCommand.Children[0].Descriptions.Long = long
+
+	err := Run(a, NewCobraExecutor())
+
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), `Deploys the app, to every region that has been
+configured, one after the other
+waiting for each to finish.
+
+Regions:
+	eu      europe
+	us      north america
+
+    helper deploy --name web   # deploys web
+
+Usage:`)
+}
+
+func TestRun_HelpColorNeedsATerminal(t *testing.T) {
+	out := &bytes.Buffer{}
+	a := helpApp(&testHelpConf{}, &HelpOptions{Color: true}, []string{"--help"}, out)
+	a.Environ = Environ{}
+
+	err := Run(a, NewCobraExecutor())
+
+	assert.Nil(t, err)
+	assert.NotContains(t, out.String(), "\x1b[")
+}
+
+func TestRun_HelpWidthFromColumns(t *testing.T) {
+	out := &bytes.Buffer{}
+	a := helpApp(&testHelpConf{}, &HelpOptions{}, []string{"deploy", "--help"}, out)
+	a.Environ = Environ{"COLUMNS": "50"}
+
+	err := Run(a, NewCobraExecutor())
+
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "Deploy the app to every region that has been\nconfigured")
+}
+
+func TestRun_InvalidHelpTemplate(t *testing.T) {
+	err := Run(helpApp(&testHelpConf{}, &HelpOptions{Template: "{{.Nope"}, []string{"--help"}, &bytes.Buffer{}), NewCobraExecutor())
+
+	var invalid ErrInvalidHelpTemplate
+	assert.True(t, errors.As(err, &invalid))
+}
@@ -0,0 +1,358 @@
+package clapp
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var ErrConfigNotReloadable error = errors.New("config was not loaded by Run so cannot be reloaded")
+
+const defaultPollInterval time.Duration = 2 * time.Second
+
+// ConfigValidator can be implemented by a config struct to check a reloaded
+// config before it replaces the current one.
+type ConfigValidator interface {
+	Validate() error
+}
+
+// ConfigChangeFunc is called with the previous and new config after a reload.
+type ConfigChangeFunc func(old interface{}, new interface{})
+
+type WatchOptions struct {
+	// PollInterval is how often the config files are checked for changes,
+	// defaults to 2 seconds
+	PollInterval time.Duration
+
+	// DisableSignal stops SIGHUP from triggering a reload
+	DisableSignal bool
+
+	// OnError is called when a reload fails, the current config is kept. The
+	// error is logged when this is nil.
+	OnError func(error)
+}
+
+// configHolder allows the config returned by ConfigFromContext to be swapped
+// out when it is reloaded.
+type configHolder struct {
+	mu  sync.RWMutex
+	cfg interface{}
+}
+
+func (h *configHolder) Load() interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.cfg
+}
+
+func (h *configHolder) Swap(cfg interface{}) interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old := h.cfg
+	h.cfg = cfg
+
+	return old
+}
+
+// liveConfig holds everything needed to rebuild the config from scratch. mu
+// guards files and subscribers, along with the dotEnv of the Config that is
+// reloaded, as they change when the config is reloaded.
+type liveConfig struct {
+	mu sync.Mutex
+
+	// reloading makes reloads run one at a time
+	reloading sync.Mutex
+
+	holder      *configHolder
+	defaults    interface{}
+	flagged     interface{}
+	files       []string
+	subscribers []ConfigChangeFunc
+}
+
+func trackLiveOpt(l *liveConfig) configOpt {
+	return func(c *Config) {
+		c.live = l
+	}
+}
+
+func newLiveConfig(holder *configHolder, cfg interface{}) *liveConfig {
+	return &liveConfig{
+		holder:   holder,
+		defaults: deepCopy(cfg),
+		flagged:  cfg,
+	}
+}
+
+// builtinDefaults returns the config as it was before any source was loaded.
+func (c *Config) builtinDefaults() interface{} {
+	if c == nil || c.live == nil {
+		return nil
+	}
+
+	return c.live.defaults
+}
+
+// Subscribe registers f to be called whenever the config is reloaded.
+func (c *Config) Subscribe(f ConfigChangeFunc) error {
+	if c.live == nil {
+		return ErrConfigNotReloadable
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+
+	c.live.subscribers = append(c.live.subscribers, f)
+
+	return nil
+}
+
+// Reload rebuilds the config from its defaults, running the sources and then
+// layering flags on top as happens in Run. The new config is validated and then
+// replaces the value returned by ConfigFromContext before subscribers are
+// notified.
+func (c *Config) Reload() error {
+	if c.live == nil {
+		return ErrConfigNotReloadable
+	}
+
+	c.live.reloading.Lock()
+	defer c.live.reloading.Unlock()
+
+	// the sources run against a copy of c, so nothing reading c sees a reload
+	// halfway through, and the results are swapped in once they all succeed
+	loader := *c
+	loader.live = &liveConfig{}
+	fresh := deepCopy(c.live.defaults)
+
+	if err := loader.runSources(c.sourcesCtx, fresh); err != nil {
+		return err
+	}
+
+	c.overrideWithFlags(c.live.flagged, fresh)
+
+	if v, ok := fresh.(ConfigValidator); ok {
+		if err := v.Validate(); err != nil {
+			return ErrInvalidConfig{
+				wrapped: err,
+			}
+		}
+	}
+
+	c.live.mu.Lock()
+	c.dotEnv = loader.dotEnv
+	c.live.files = loader.live.files
+	subscribers := append([]ConfigChangeFunc{}, c.live.subscribers...)
+	c.live.mu.Unlock()
+
+	old := c.live.holder.Swap(fresh)
+
+	for _, f := range subscribers {
+		f(old, fresh)
+	}
+
+	return nil
+}
+
+// snapshot copies c, so a reload can't change it while it is being copied.
+func (c *Config) snapshot() Config {
+	if c.live == nil {
+		return *c
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+
+	return *c
+}
+
+// dotEnvVars are the variables loaded from .env files by the last load.
+func (c *Config) dotEnvVars() map[string]string {
+	if c.live == nil {
+		return c.dotEnv
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+
+	return c.dotEnv
+}
+
+func (c *Config) fileHashes() map[string][32]byte {
+	hashes := map[string][32]byte{}
+
+	c.live.mu.Lock()
+	files := append([]string{}, c.live.files...)
+	c.live.mu.Unlock()
+
+	for _, f := range files {
+		b, err := afero.ReadFile(c.fs, f)
+
+		if err != nil {
+			// a missing file gets the zero hash, so it appearing is a change
+			hashes[f] = [32]byte{}
+			continue
+		}
+
+		hashes[f] = sha256.Sum256(b)
+	}
+
+	return hashes
+}
+
+func hashesDiffer(a map[string][32]byte, b map[string][32]byte) bool {
+	if len(a) != len(b) {
+		return true
+	}
+
+	for k, v := range a {
+		if b[k] != v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch reloads the config whenever one of the files it was loaded from
+// changes, or the process receives SIGHUP. Files are polled through the
+// app's filesystem so this works with any afero.Fs. It returns once the
+// watcher is running, the watcher stops when ctx is done.
+func (c *Config) Watch(ctx context.Context, opts WatchOptions) error {
+	if c.live == nil {
+		return ErrConfigNotReloadable
+	}
+
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	onError := opts.OnError
+	if onError == nil {
+		l := LoggerFromContext(ctx)
+		onError = func(err error) {
+			l.Error().Err(err).Msg("failed to reload config")
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	if !opts.DisableSignal {
+		signal.Notify(sigs, syscall.SIGHUP)
+	}
+
+	last := c.fileHashes()
+	ticker := time.NewTicker(interval)
+
+	reload := func() {
+		if err := c.Reload(); err != nil {
+			onError(err)
+		}
+
+		last = c.fileHashes()
+	}
+
+	go func() {
+		defer ticker.Stop()
+		defer signal.Stop(sigs)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				reload()
+			case <-ticker.C:
+				if hashesDiffer(last, c.fileHashes()) {
+					reload()
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func deepCopy(cfg interface{}) interface{} {
+	return deepCopyValue(reflect.ValueOf(cfg)).Interface()
+}
+
+func deepCopyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(deepCopyValue(v.Elem()))
+
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		// copy unexported fields as they are, then replace exported ones
+		cp.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+
+			cp.Field(i).Set(deepCopyValue(v.Field(i)))
+		}
+
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			cp.SetMapIndex(k, deepCopyValue(v.MapIndex(k)))
+		}
+
+		return cp
+	}
+
+	return v
+}
+
+func setFieldByPath(v reflect.Value, path []string, val reflect.Value) {
+	for i, name := range path {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.FieldByName(name)
+
+		if i == len(path)-1 {
+			v.Set(val)
+		}
+	}
+}
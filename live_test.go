@@ -0,0 +1,298 @@
+package clapp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+type validatedConf struct {
+	Name string `yaml:"name"`
+}
+
+func (c *validatedConf) Validate() error {
+	if c.Name == "invalid" {
+		return errors.New("name cannot be invalid")
+	}
+
+	return nil
+}
+
+// flagSimulatingExecutor mimics a flag bound to a config field being set.
+type flagSimulatingExecutor struct {
+	ctx     context.Context
+	setFlag func(ctx context.Context, cfg interface{})
+}
+
+func (e *flagSimulatingExecutor) Run(c Command, ctx context.Context, cfg interface{}) error {
+	e.ctx = ctx
+
+	if e.setFlag != nil {
+		e.setFlag(ctx, cfg)
+	}
+
+	return nil
+}
+
+func TestDeepCopy(t *testing.T) {
+	orig := &struct {
+		List   []string
+		Map    map[string]int
+		Ptr    *testExtEndpoint
+		Nested testExtEndpoint
+	}{
+		List:   []string{"a"},
+		Map:    map[string]int{"a": 1},
+		Ptr:    &testExtEndpoint{Domain: "ptr"},
+		Nested: testExtEndpoint{Domain: "nested"},
+	}
+
+	cp := deepCopy(orig).(*struct {
+		List   []string
+		Map    map[string]int
+		Ptr    *testExtEndpoint
+		Nested testExtEndpoint
+	})
+
+	assert.Equal(t, orig, cp)
+
+	cp.List[0] = "b"
+	cp.Map["a"] = 2
+	cp.Ptr.Domain = "changed"
+
+	assert.Equal(t, "a", orig.List[0])
+	assert.Equal(t, 1, orig.Map["a"])
+	assert.Equal(t, "ptr", orig.Ptr.Domain)
+}
+
+func TestConfig_Reload(t *testing.T) {
+	fs := buildMockFs()
+	assert.Nil(t, afero.WriteFile(fs, "/reload/reloader.yaml", []byte(`should-enable-this: first
+should-do-that: first
+`), 0644))
+
+	cfg := &testConf{
+		ExternalEndpoint: testExtEndpoint{
+			Port: 80,
+		},
+	}
+	exec := &flagSimulatingExecutor{
+		setFlag: func(ctx context.Context, cfg interface{}) {
+			v := "from-flag"
+			applyFlag(ctx, &cfg.(*testConf).ShouldDoThat, &v)
+		},
+	}
+
+	err := Run(App{
+		Config:     cfg,
+		ConfigPath: "/reload/reloader.yaml",
+		Fs:         fs,
+		Args:       []string{},
+		RootCommand: Command{
+			Name: "reloader",
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+	assert.Equal(t, cfg, ConfigFromContext(exec.ctx))
+
+	mgr := ConfigManagerFromContext(exec.ctx)
+	notified := [][]interface{}{}
+	assert.Nil(t, mgr.Subscribe(func(old interface{}, new interface{}) {
+		notified = append(notified, []interface{}{old, new})
+	}))
+
+	assert.Nil(t, afero.WriteFile(fs, "/reload/reloader.yaml", []byte(`should-enable-this: second
+should-do-that: second
+`), 0644))
+
+	os.Setenv("RELOADER_EXTERNAL_ENDPOINT_DOMAIN", "from-env")
+	defer os.Unsetenv("RELOADER_EXTERNAL_ENDPOINT_DOMAIN")
+
+	assert.Nil(t, mgr.Reload())
+
+	reloaded := ConfigFromContext(exec.ctx).(*testConf)
+	assert.Equal(t, &testConf{
+		ShouldEnableThis: "second",
+		// flags still take precedence over the file
+		ShouldDoThat: "from-flag",
+		ExternalEndpoint: testExtEndpoint{
+			Domain: "from-env",
+			// defaults are kept
+			Port: 80,
+		},
+	}, reloaded)
+
+	// the original value is not modified
+	assert.Equal(t, "first", cfg.ShouldEnableThis)
+	assert.Equal(t, [][]interface{}{{cfg, reloaded}}, notified)
+}
+
+func TestConfig_Reload_InvalidConfigIsNotSwapped(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/validated.yaml", []byte("name: valid"), 0644))
+
+	cfg := &validatedConf{}
+	exec := &flagSimulatingExecutor{}
+
+	err := Run(App{
+		Config:     cfg,
+		ConfigPath: "/validated.yaml",
+		Fs:         fs,
+		Args:       []string{},
+		RootCommand: Command{
+			Name: "validated",
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+
+	assert.Nil(t, afero.WriteFile(fs, "/validated.yaml", []byte("name: invalid"), 0644))
+
+	err = ConfigManagerFromContext(exec.ctx).Reload()
+
+	assert.Equal(t, ErrInvalidConfig{wrapped: errors.New("name cannot be invalid")}, err)
+	assert.True(t, cfg == ConfigFromContext(exec.ctx))
+
+	assert.Nil(t, afero.WriteFile(fs, "/validated.yaml", []byte("name: [broken"), 0644))
+	assert.IsType(t, ErrUnmarshallingYAML{}, ConfigManagerFromContext(exec.ctx).Reload())
+	assert.Equal(t, "valid", ConfigFromContext(exec.ctx).(*validatedConf).Name)
+}
+
+// run with -race to check reloads don't race with reads of the config
+func TestConfig_Reload_Concurrent(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/racer.yaml", []byte("should-do-that: file\n"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/.env", []byte("RACER_SHOULD_ENABLE_THIS=dotenv\n"), 0644))
+
+	cfg := &testConf{}
+	exec := &flagSimulatingExecutor{}
+
+	err := Run(App{
+		Config:     cfg,
+		ConfigPath: "/racer.yaml",
+		Fs:         fs,
+		Args:       []string{},
+		Environ:    Environ{},
+		Sources:    []Source{DotEnvSource{Path: "/.env"}, FileSource(), EnvSource()},
+		RootCommand: Command{
+			Name: "racer",
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+
+	mgr := ConfigManagerFromContext(exec.ctx)
+	assert.Nil(t, mgr.Subscribe(func(interface{}, interface{}) {}))
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 50; i++ {
+			if err := mgr.Reload(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+
+		assert.Equal(t, "dotenv", ConfigFromContext(exec.ctx).(*testConf).ShouldEnableThis)
+
+		v, _ := mgr.getenv("RACER_SHOULD_ENABLE_THIS")
+		assert.Equal(t, "dotenv", v)
+
+		_, err := mgr.UnknownEnvVars(&testConf{})
+		assert.Nil(t, err)
+
+		assert.Nil(t, mgr.LoadCommandConfig(Command{Name: "sub"}, &testConf{}))
+		mgr.fileHashes()
+	}
+
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+}
+
+func TestConfig_Watch(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/watched.yaml", []byte("name: first"), 0644))
+
+	cfg := &validatedConf{}
+	exec := &flagSimulatingExecutor{}
+
+	err := Run(App{
+		Config:     cfg,
+		ConfigPath: "/watched.yaml",
+		Fs:         fs,
+		Args:       []string{},
+		RootCommand: Command{
+			Name: "watched",
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(exec.ctx)
+	defer cancel()
+
+	mgr := ConfigManagerFromContext(ctx)
+	changes := make(chan string, 1)
+	errs := make(chan error, 1)
+
+	assert.Nil(t, mgr.Subscribe(func(old interface{}, new interface{}) {
+		changes <- new.(*validatedConf).Name
+	}))
+
+	assert.Nil(t, mgr.Watch(ctx, WatchOptions{
+		PollInterval:  5 * time.Millisecond,
+		DisableSignal: true,
+		OnError: func(err error) {
+			errs <- err
+		},
+	}))
+
+	assert.Nil(t, afero.WriteFile(fs, "/watched.yaml", []byte("name: second"), 0644))
+
+	select {
+	case name := <-changes:
+		assert.Equal(t, "second", name)
+	case <-time.After(time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	assert.Nil(t, afero.WriteFile(fs, "/watched.yaml", []byte("name: invalid"), 0644))
+
+	select {
+	case err := <-errs:
+		assert.IsType(t, ErrInvalidConfig{}, err)
+	case <-time.After(time.Second):
+		t.Fatal("reload error was not reported")
+	}
+
+	assert.Equal(t, "second", ConfigFromContext(ctx).(*validatedConf).Name)
+}
+
+func TestConfig_NotReloadable(t *testing.T) {
+	c := &Config{}
+
+	assert.Equal(t, ErrConfigNotReloadable, c.Reload())
+	assert.Equal(t, ErrConfigNotReloadable, c.Subscribe(func(old interface{}, new interface{}) {}))
+	assert.Equal(t, ErrConfigNotReloadable, c.Watch(context.TODO(), WatchOptions{}))
+}
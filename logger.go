@@ -3,6 +3,7 @@ package clapp
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
 	"reflect"
 
@@ -12,7 +13,19 @@ import (
 var ErrInvalidLogFormat error = errors.New("log format must be one of: console, json")
 
 type LogManager struct {
-	logger zerolog.Logger
+	logger  zerolog.Logger
+	noColor bool
+
+	// out is where ChangeOutput sends logs, os.Stderr when nil
+	out io.Writer
+}
+
+// noColor reports whether NO_COLOR is set to a non-empty value, in which case
+// the console log format is written without colour. See https://no-color.org
+func noColor(lookupEnv func(string) (string, bool)) bool {
+	v, ok := lookupEnv("NO_COLOR")
+
+	return ok && v != ""
 }
 
 func (lm *LogManager) ChangeLevel(l int) {
@@ -20,11 +33,17 @@ func (lm *LogManager) ChangeLevel(l int) {
 }
 
 func (lm *LogManager) ChangeOutput(f string) error {
+	out := lm.out
+
+	if out == nil {
+		out = os.Stderr
+	}
+
 	switch f {
 	case "console":
-		lm.logger = lm.logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		lm.logger = lm.logger.Output(zerolog.ConsoleWriter{Out: out, NoColor: lm.noColor})
 	case "json":
-		lm.logger = lm.logger.Output(os.Stderr)
+		lm.logger = lm.logger.Output(out)
 	default:
 		return ErrInvalidLogFormat
 	}
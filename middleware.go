@@ -0,0 +1,76 @@
+package clapp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Middleware wraps a command's handler, e.g. to time it or check the user is
+// authorised to run it. It must call next to run the command.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// withMiddleware wraps the handler of every command in the tree with the
+// middleware of the command and its parents, starting with inherited. The
+// first middleware is the outermost.
+func withMiddleware(cmd Command, inherited []Middleware) Command {
+	chain := append(append([]Middleware{}, inherited...), cmd.Middleware...)
+
+	children := make([]Command, len(cmd.Children))
+	for i, child := range cmd.Children {
+		children[i] = withMiddleware(child, chain)
+	}
+
+	cmd.Children = children
+
+	if cmd.Handle == nil {
+		return cmd
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		cmd.Handle = chain[i](cmd.Handle)
+	}
+
+	return cmd
+}
+
+// RecoverMiddleware turns a panic in the handler into an ErrHandlerPanicked.
+// Run already does this for every command, this lets middleware further out
+// see the error.
+func RecoverMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(cmd *cobra.Command, args []string) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = handlerPanicked(cmd, r)
+				}
+			}()
+
+			return next(cmd, args)
+		}
+	}
+}
+
+// TimingMiddleware logs how long the handler took at debug level.
+func TimingMiddleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(cmd *cobra.Command, args []string) error {
+			start := time.Now()
+			err := next(cmd, args)
+
+			l := LoggerFromContext(cmd.Context())
+			l.Debug().Str("command", cmd.CommandPath()).Dur("duration", time.Since(start)).Bool("failed", err != nil).Msg("command finished")
+
+			return err
+		}
+	}
+}
+
+func panicMessage(v interface{}) string {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+
+	return fmt.Sprint(v)
+}
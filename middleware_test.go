@@ -0,0 +1,226 @@
+package clapp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(cmd *cobra.Command, args []string) error {
+			*calls = append(*calls, name+":before")
+			err := next(cmd, args)
+			*calls = append(*calls, name+":after")
+
+			return err
+		}
+	}
+}
+
+func TestRun_Middleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name: "root runs inside app and root middleware",
+			args: []string{},
+			expected: []string{
+				"app:before",
+				"root:before",
+				"handle:root",
+				"root:after",
+				"app:after",
+			},
+		},
+		{
+			name: "children inherit middleware",
+			args: []string{"child", "grandchild"},
+			expected: []string{
+				"app:before",
+				"root:before",
+				"child:before",
+				"grandchild:before",
+				"handle:grandchild",
+				"grandchild:after",
+				"child:after",
+				"root:after",
+				"app:after",
+			},
+		},
+		{
+			name:     "commands without a handler are not wrapped",
+			args:     []string{"group"},
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			calls := []string{}
+			handle := func(name string) HandlerFunc {
+				return func(cmd *cobra.Command, args []string) error {
+					calls = append(calls, "handle:"+name)
+					return nil
+				}
+			}
+
+			err := Run(App{
+				Config:     &testConf{},
+				Fs:         afero.NewMemMapFs(),
+				Args:       test.args,
+				Environ:    Environ{},
+				Middleware: []Middleware{recordingMiddleware("app", &calls)},
+				RootCommand: Command{
+					Name:       "mw",
+					Handle:     handle("root"),
+					Middleware: []Middleware{recordingMiddleware("root", &calls)},
+					CustomConfiguration: func(cmd *cobra.Command) {
+						cmd.SetOut(&bytes.Buffer{})
+					},
+					Children: []Command{
+						{
+							Name:       "child",
+							Handle:     handle("child"),
+							Middleware: []Middleware{recordingMiddleware("child", &calls)},
+							Children: []Command{
+								{
+									Name:       "grandchild",
+									Handle:     handle("grandchild"),
+									Middleware: []Middleware{recordingMiddleware("grandchild", &calls)},
+								},
+							},
+						},
+						{
+							Name: "group",
+						},
+					},
+				},
+			}, NewCobraExecutor())
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, calls)
+		})
+	}
+}
+
+func TestRun_MiddlewareSeesCommandConfig(t *testing.T) {
+	var seen interface{}
+
+	err := Run(App{
+		Config:  &testConf{},
+		Fs:      afero.NewMemMapFs(),
+		Args:    []string{"server"},
+		Environ: Environ{},
+		RootCommand: Command{
+			Name: "mw",
+			Children: []Command{
+				{
+					Name:   "server",
+					Config: &testServerConf{Port: 80},
+					Middleware: []Middleware{
+						func(next HandlerFunc) HandlerFunc {
+							return func(cmd *cobra.Command, args []string) error {
+								seen = CommandConfigFromContext(cmd.Context())
+								return next(cmd, args)
+							}
+						},
+					},
+					Handle: func(cmd *cobra.Command, args []string) error {
+						return nil
+					},
+				},
+			},
+		},
+	}, NewCobraExecutor())
+
+	assert.Nil(t, err)
+	assert.Equal(t, &testServerConf{Port: 80}, seen)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		name     string
+		handle   HandlerFunc
+		expected string
+		cause    error
+	}{
+		{
+			name: "string panics",
+			handle: func(cmd *cobra.Command, args []string) error {
+				panic("oh no")
+			},
+			expected: "command recover panicked: oh no",
+		},
+		{
+			name: "error panics are unwrapped",
+			handle: func(cmd *cobra.Command, args []string) error {
+				panic(cause)
+			},
+			expected: "command recover panicked: boom",
+			cause:    cause,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			cmd := &cobra.Command{
+				Use: "recover",
+			}
+
+			err := RecoverMiddleware()(test.handle)(cmd, []string{})
+
+			var panicked ErrHandlerPanicked
+			assert.True(tt, errors.As(err, &panicked))
+			assert.Equal(tt, "recover", panicked.Command)
+			assert.NotEmpty(tt, panicked.Stack)
+			assert.EqualError(tt, err, test.expected)
+
+			if test.cause != nil {
+				assert.True(tt, errors.Is(err, test.cause))
+			}
+		})
+	}
+
+	err := RecoverMiddleware()(func(cmd *cobra.Command, args []string) error {
+		return ErrHandleError
+	})(&cobra.Command{}, []string{})
+
+	assert.Equal(t, ErrHandleError, err)
+}
+
+func TestTimingMiddleware(t *testing.T) {
+	logs := &bytes.Buffer{}
+
+	err := Run(App{
+		Config:     &testConf{},
+		Fs:         afero.NewMemMapFs(),
+		Args:       []string{},
+		Environ:    Environ{},
+		Logger:     zerolog.New(logs),
+		Middleware: []Middleware{TimingMiddleware()},
+		RootCommand: Command{
+			Name: "timed",
+			Handle: func(cmd *cobra.Command, args []string) error {
+				return ErrHandleError
+			},
+			CustomConfiguration: func(cmd *cobra.Command) {
+				cmd.SetErr(&bytes.Buffer{})
+			},
+		},
+	}, NewCobraExecutor())
+
+	assert.Equal(t, ErrHandleError, err)
+	assert.Contains(t, logs.String(), `"command":"timed"`)
+	assert.Contains(t, logs.String(), `"failed":true`)
+	assert.Contains(t, logs.String(), `"duration":`)
+	assert.Contains(t, logs.String(), `"message":"command finished"`)
+}
@@ -0,0 +1,421 @@
+package clapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrMissingOutputTemplate error = errors.New("template output needs a template e.g. template={{.Name}}")
+
+type OutputFormat string
+
+const JSONOutput OutputFormat = "json"
+const YAMLOutput OutputFormat = "yaml"
+const TableOutput OutputFormat = "table"
+const TemplateOutput OutputFormat = "template"
+
+var outputFormats = []OutputFormat{JSONOutput, YAMLOutput, TableOutput, TemplateOutput}
+
+const OutputContextKey ContextKey = "OUTPUT"
+
+// Printer writes values in the format chosen with --output, which is one of:
+//
+//	json
+//	yaml
+//	table                  every column
+//	table=name,status      the given columns, in that order
+//	template={{.Name}}     a text/template executed with the value
+//
+// Tables have a row for each item of a slice, or a single row for anything
+// else. The columns of structs are named by their json tags, maps use their
+// keys and other values have a single VALUE column. Secret fields are masked
+// in every format, as they are by DumpConfig.
+type Printer struct {
+	out    io.Writer
+	format OutputFormat
+	arg    string
+}
+
+// NewPrinter returns a Printer that writes to w in the format given by
+// output, see Printer.
+func NewPrinter(w io.Writer, output string) (*Printer, error) {
+	p := &Printer{
+		out: w,
+	}
+
+	parts := strings.SplitN(output, "=", 2)
+	p.format = OutputFormat(parts[0])
+
+	if len(parts) == 2 {
+		p.arg = parts[1]
+	}
+
+	switch p.format {
+	case JSONOutput, YAMLOutput, TableOutput:
+		return p, nil
+	case TemplateOutput:
+		if p.arg == "" {
+			return nil, ErrMissingOutputTemplate
+		}
+
+		return p, nil
+	}
+
+	names := []string{}
+	for _, f := range outputFormats {
+		names = append(names, string(f))
+	}
+
+	return nil, ErrInvalidOutputFormat{
+		Format:      p.format,
+		Suggestions: Suggest(string(p.format), names),
+	}
+}
+
+// PrinterFromContext returns a Printer for the format given with the
+// --output flag, or App.DefaultOutput when it wasn't given. It writes to
+// StdoutFromContext.
+func PrinterFromContext(ctx context.Context) (*Printer, error) {
+	output := string(TableOutput)
+
+	if o, ok := ctx.Value(OutputContextKey).(*string); ok && *o != "" {
+		output = *o
+	}
+
+	return NewPrinter(StdoutFromContext(ctx), output)
+}
+
+func contextWithOutputFormat(ctx context.Context, output *string) context.Context {
+	return context.WithValue(
+		ctx,
+		OutputContextKey,
+		output,
+	)
+}
+
+func (p *Printer) Print(v interface{}) error {
+	v = maskSecrets(v)
+
+	switch p.format {
+	case JSONOutput:
+		enc := json.NewEncoder(p.out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	case YAMLOutput:
+		enc := yaml.NewEncoder(p.out)
+		enc.SetIndent(2)
+
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+
+		return enc.Close()
+	case TemplateOutput:
+		tmpl, err := template.New("output").Parse(p.arg)
+
+		if err != nil {
+			return err
+		}
+
+		return tmpl.Execute(p.out, v)
+	}
+
+	return p.printTable(v)
+}
+
+func (p *Printer) printTable(v interface{}) error {
+	rows := tableRows(reflect.ValueOf(v))
+	columns := tableColumns(rows)
+
+	if p.arg != "" {
+		selected := []string{}
+
+		for _, name := range strings.Split(p.arg, ",") {
+			name = strings.TrimSpace(name)
+			col, ok := findColumn(columns, name)
+
+			if !ok {
+				return ErrUnknownOutputColumn{
+					Column:      name,
+					Suggestions: Suggest(name, columns),
+				}
+			}
+
+			selected = append(selected, col)
+		}
+
+		columns = selected
+	}
+
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 8, 3, ' ', 0)
+
+	headers := []string{}
+	for _, c := range columns {
+		headers = append(headers, strings.ToUpper(c))
+	}
+
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for _, row := range rows {
+		cells := []string{}
+		for _, c := range columns {
+			cells = append(cells, row.cells[c])
+		}
+
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// empty cells at the end of a row are padded, which isn't wanted
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+
+	_, err := fmt.Fprintf(p.out, "%s\n", strings.Join(lines, "\n"))
+
+	return err
+}
+
+func findColumn(columns []string, name string) (string, bool) {
+	for _, c := range columns {
+		if strings.EqualFold(c, name) {
+			return c, true
+		}
+	}
+
+	return "", false
+}
+
+// tableRow is the cells of a row keyed by column, columns keeps the order
+// they should be shown in.
+type tableRow struct {
+	columns []string
+	cells   map[string]string
+}
+
+func (r *tableRow) add(column string, cell string) {
+	if _, ok := r.cells[column]; !ok {
+		r.columns = append(r.columns, column)
+	}
+
+	r.cells[column] = cell
+}
+
+// tableRows turns v into rows, a slice or array is a row for each item.
+func tableRows(v reflect.Value) []tableRow {
+	v = indirect(v)
+
+	if isList(v) {
+		rows := []tableRow{}
+
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, newTableRow(v.Index(i)))
+		}
+
+		return rows
+	}
+
+	return []tableRow{newTableRow(v)}
+}
+
+const valueColumn string = "value"
+
+func newTableRow(v reflect.Value) tableRow {
+	v = indirect(v)
+	row := tableRow{
+		columns: []string{},
+		cells:   map[string]string{},
+	}
+
+	if !v.IsValid() {
+		return row
+	}
+
+	stringer := false
+	if v.CanInterface() {
+		_, stringer = v.Interface().(fmt.Stringer)
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct && !stringer:
+		addStructCells(&row, v)
+
+		return row
+	case v.Kind() == reflect.Map:
+		keys := []string{}
+		values := map[string]reflect.Value{}
+		iter := v.MapRange()
+
+		for iter.Next() {
+			k := fmt.Sprint(iter.Key().Interface())
+			keys = append(keys, k)
+			values[k] = iter.Value()
+		}
+
+		// maps have no order so the keys are sorted
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			row.add(k, tableCell(values[k]))
+		}
+
+		return row
+	}
+
+	row.add(valueColumn, tableCell(v))
+
+	return row
+}
+
+// addStructCells adds the exported fields of v, named as encoding/json would
+// name them. Embedded structs without a name are flattened.
+func addStructCells(row *tableRow, v reflect.Value) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Name
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		fv := indirect(v.Field(i))
+
+		if tag == "-" {
+			continue
+		}
+
+		// the exported fields of embedded structs are used even when the
+		// struct's type is unexported, as encoding/json does
+		if f.Anonymous && tag == "" && fv.IsValid() && fv.Kind() == reflect.Struct {
+			addStructCells(row, fv)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if tag != "" {
+			name = tag
+		}
+
+		row.add(name, tableCell(fv))
+	}
+}
+
+func tableCell(v reflect.Value) string {
+	v = indirect(v)
+
+	if !v.IsValid() {
+		return ""
+	}
+
+	// fields reached through an unexported embedded struct can't be turned
+	// back into an interface, fmt can still format them
+	if !v.CanInterface() {
+		return fmt.Sprint(v)
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	if isList(v) {
+		items := []string{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, tableCell(v.Index(i)))
+		}
+
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+// isList reports whether v is a slice or array, other than []byte.
+func isList(v reflect.Value) bool {
+	return v.IsValid() && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// tableColumns lists the columns of every row, in the order they first
+// appear.
+func tableColumns(rows []tableRow) []string {
+	columns := []string{}
+	seen := map[string]bool{}
+
+	for _, row := range rows {
+		for _, c := range row.columns {
+			if !seen[c] {
+				seen[c] = true
+				columns = append(columns, c)
+			}
+		}
+	}
+
+	return columns
+}
+
+// builtinOutput adds the --output flag to the root command, it returns where
+// the flag's value is parsed into. A format given on the command line is
+// checked now so a mistake is reported before the command runs, reading args
+// with the executor's flag syntax so e.g. -only=x isn't taken as -o nly.
+func builtinOutput(root *Command, args []string, def string, pre FlagPreParser) (*string, error) {
+	output := def
+
+	if output == "" {
+		output = string(TableOutput)
+	}
+
+	f, added := addBuiltinFlag(root, Flag{
+		Name:        "output",
+		Short:       "o",
+		Description: "Output format: json, yaml, table, table=<columns> or template=<template>",
+		ValueRef:    &output,
+		Type:        StringFlag,
+	})
+
+	if !added {
+		return &output, nil
+	}
+
+	given := pre.PreParseFlag(args, f)
+	check := output
+
+	if len(given) > 0 {
+		check = given[len(given)-1]
+	}
+
+	if _, err := NewPrinter(ioutil.Discard, check); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
@@ -0,0 +1,366 @@
+package clapp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type testOutputMeta struct {
+	Region string `json:"region"`
+}
+
+type testOutputItem struct {
+	testOutputMeta
+	Name    string   `json:"name"`
+	Status  string   `json:"status,omitempty"`
+	Tags    []string `json:"tags"`
+	Owner   *string  `json:"owner"`
+	Ignored string   `json:"-"`
+	hidden  string
+}
+
+type testOutputStringer struct {
+	N int
+}
+
+func (s testOutputStringer) String() string {
+	return "stringer"
+}
+
+func testOutputItems() []testOutputItem {
+	owner := "bob"
+
+	return []testOutputItem{
+		{
+			testOutputMeta: testOutputMeta{Region: "eu"},
+			Name:           "web",
+			Status:         "running",
+			Tags:           []string{"a", "b"},
+			Owner:          &owner,
+			Ignored:        "ignored",
+			hidden:         "hidden",
+		},
+		{
+			testOutputMeta: testOutputMeta{Region: "us"},
+			Name:           "worker-long-name",
+			Status:         "stopped",
+		},
+	}
+}
+
+func TestPrinter_Print(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:   "json",
+			output: "json",
+			value:  testOutputItems()[1],
+			expected: `{
+  "region": "us",
+  "name": "worker-long-name",
+  "status": "stopped",
+  "tags": null,
+  "owner": null
+}
+`,
+		},
+		{
+			name:   "yaml",
+			output: "yaml",
+			value: map[string]interface{}{
+				"name": "web",
+				"tags": []string{"a", "b"},
+			},
+			expected: `name: web
+tags:
+  - a
+  - b
+`,
+		},
+		{
+			name:   "table of structs",
+			output: "table",
+			value:  testOutputItems(),
+			expected: `REGION   NAME               STATUS    TAGS   OWNER
+eu       web                running   a,b    bob
+us       worker-long-name   stopped
+`,
+		},
+		{
+			name:   "selected columns",
+			output: "table=Name, status",
+			value:  testOutputItems(),
+			expected: `NAME               STATUS
+web                running
+worker-long-name   stopped
+`,
+		},
+		{
+			name:   "single struct",
+			output: "table=name",
+			value:  &testOutputItems()[0],
+			expected: `NAME
+web
+`,
+		},
+		{
+			name:   "maps",
+			output: "table",
+			value: []map[string]int{
+				{"b": 2, "a": 1},
+				{"c": 3},
+			},
+			expected: `A   B   C
+1   2
+        3
+`,
+		},
+		{
+			name:   "scalars",
+			output: "table",
+			value:  []interface{}{"one", 2, testOutputStringer{}},
+			expected: `VALUE
+one
+2
+stringer
+`,
+		},
+		{
+			name:     "template",
+			output:   "template={{range .}}{{.Name}}={{.Region}} {{end}}",
+			value:    testOutputItems(),
+			expected: "web=eu worker-long-name=us ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			p, err := NewPrinter(out, test.output)
+
+			assert.Nil(tt, err)
+			assert.Nil(tt, p.Print(test.value))
+			assert.Equal(tt, test.expected, out.String())
+		})
+	}
+}
+
+func TestNewPrinter_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected error
+	}{
+		{
+			name:   "unknown formats",
+			output: "jsn",
+			expected: ErrInvalidOutputFormat{
+				Format:      "jsn",
+				Suggestions: []string{"json"},
+			},
+		},
+		{
+			name:     "templates without a template",
+			output:   "template",
+			expected: ErrMissingOutputTemplate,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			p, err := NewPrinter(&bytes.Buffer{}, test.output)
+
+			assert.Nil(tt, p)
+			assert.Equal(tt, test.expected, err)
+		})
+	}
+
+	assert.EqualError(t, ErrInvalidOutputFormat{Format: "jsn", Suggestions: []string{"json"}}, `output format must be one of json, yaml, table, template, got "jsn", did you mean "json"?`)
+}
+
+func TestPrinter_UnknownColumn(t *testing.T) {
+	p, err := NewPrinter(&bytes.Buffer{}, "table=name,stauts")
+	assert.Nil(t, err)
+
+	err = p.Print(testOutputItems())
+
+	assert.Equal(t, ErrUnknownOutputColumn{
+		Column:      "stauts",
+		Suggestions: []string{"status"},
+	}, err)
+}
+
+func TestRun_OutputFlag(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		outputFlag    bool
+		defaultOutput string
+		expected      string
+		err           error
+	}{
+		{
+			name:       "table by default",
+			args:       []string{"list"},
+			outputFlag: true,
+			expected:   "NAME\nweb\n",
+		},
+		{
+			name:       "long flag",
+			args:       []string{"list", "--output", "json"},
+			outputFlag: true,
+			expected:   "{\n  \"name\": \"web\"\n}\n",
+		},
+		{
+			name:       "short flag before the command",
+			args:       []string{"-o", "template={{.Name}}", "list"},
+			outputFlag: true,
+			expected:   "web",
+		},
+		{
+			name:          "default output",
+			args:          []string{"list"},
+			outputFlag:    true,
+			defaultOutput: "yaml",
+			expected:      "name: web\n",
+		},
+		{
+			name:          "default output without the flag",
+			args:          []string{"list"},
+			defaultOutput: "yaml",
+			expected:      "name: web\n",
+		},
+		{
+			name:       "invalid formats fail before the command runs",
+			args:       []string{"list", "-o", "tabel"},
+			outputFlag: true,
+			err: ErrInvalidOutputFormat{
+				Format:      "tabel",
+				Suggestions: []string{"table"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			ran := false
+
+			err := Run(App{
+				Config:        &testConf{},
+				Fs:            afero.NewMemMapFs(),
+				Args:          test.args,
+				Environ:       Environ{},
+				Stdout:        out,
+				Stderr:        &bytes.Buffer{},
+				OutputFlag:    test.outputFlag,
+				DefaultOutput: test.defaultOutput,
+				RootCommand: Command{
+					Name: "printer",
+					Children: []Command{
+						{
+							Name: "list",
+							Handle: func(cmd *cobra.Command, args []string) error {
+								ran = true
+								p, err := PrinterFromContext(cmd.Context())
+
+								if err != nil {
+									return err
+								}
+
+								return p.Print(struct {
+									Name string `json:"name" yaml:"name"`
+								}{
+									Name: "web",
+								})
+							},
+						},
+					},
+				},
+			}, NewCobraExecutor())
+
+			if test.err != nil {
+				assert.Equal(tt, test.err, err)
+				assert.False(tt, ran)
+				return
+			}
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expected, out.String())
+		})
+	}
+}
+
+type testOutputSecrets struct {
+	User     string `json:"user"`
+	Password string `json:"password" secret:"true"`
+	Token    Secret `json:"token"`
+	Pin      int    `json:"pin" clapp:"secret"`
+	Empty    string `json:"empty" secret:"true"`
+}
+
+func TestPrinter_MasksSecrets(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{
+			output: "json",
+			expected: `[
+  {
+    "user": "admin",
+    "password": "******",
+    "token": "******",
+    "pin": 0,
+    "empty": ""
+  }
+]
+`,
+		},
+		{
+			output: "yaml",
+			expected: `- user: admin
+  password: '******'
+  token: '******'
+  pin: 0
+  empty: ""
+`,
+		},
+		{
+			output:   "table=user,password,token",
+			expected: "USER    PASSWORD   TOKEN\nadmin   ******     ******\n",
+		},
+		{
+			output:   "template={{range .}}{{.Password}}{{end}}",
+			expected: "******",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.output, func(tt *testing.T) {
+			v := []*testOutputSecrets{
+				{
+					User:     "admin",
+					Password: "hunter2",
+					Token:    "abc123",
+					Pin:      1234,
+				},
+			}
+			out := &bytes.Buffer{}
+			p, err := NewPrinter(out, test.output)
+
+			assert.Nil(tt, err)
+			assert.Nil(tt, p.Print(v))
+			assert.Equal(tt, test.expected, out.String())
+			assert.Equal(tt, "hunter2", v[0].Password, "the value printed is left alone")
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package clapp
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// PanicExitCode is the exit code for ErrHandlerPanicked, EX_SOFTWARE from
+// sysexits.h
+const PanicExitCode int = 70
+
+const CleanupContextKey ContextKey = "CLEANUP"
+
+// CleanupFunc releases something held while a command runs.
+type CleanupFunc func(ctx context.Context)
+
+type cleanupHooks struct {
+	mu    sync.Mutex
+	hooks []CleanupFunc
+}
+
+// OnCleanup registers f to run once the handler of the running command has
+// returned or panicked. Hooks run in the reverse of the order they were
+// registered, after those in App.Cleanup.
+func OnCleanup(ctx context.Context, f CleanupFunc) {
+	h, ok := ctx.Value(CleanupContextKey).(*cleanupHooks)
+
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.hooks = append(h.hooks, f)
+}
+
+func contextWithCleanup(ctx context.Context, hooks []CleanupFunc) context.Context {
+	return context.WithValue(
+		ctx,
+		CleanupContextKey,
+		&cleanupHooks{
+			hooks: append([]CleanupFunc{}, hooks...),
+		},
+	)
+}
+
+func runCleanup(ctx context.Context) {
+	h, ok := ctx.Value(CleanupContextKey).(*cleanupHooks)
+
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	hooks := h.hooks
+	h.hooks = nil
+	h.mu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](ctx)
+	}
+}
+
+func handlerPanicked(cmd *cobra.Command, v interface{}) ErrHandlerPanicked {
+	return ErrHandlerPanicked{
+		Command: cmd.CommandPath(),
+		Value:   v,
+		Stack:   debug.Stack(),
+	}
+}
+
+// withPanicRecovery wraps the handler of every command in the tree so a panic
+// is logged and returned as an ErrHandlerPanicked. The cleanup hooks run
+// after the handler whether or not it panicked.
+func withPanicRecovery(cmd Command) Command {
+	children := make([]Command, len(cmd.Children))
+	for i, child := range cmd.Children {
+		children[i] = withPanicRecovery(child)
+	}
+
+	cmd.Children = children
+
+	if cmd.Handle == nil {
+		return cmd
+	}
+
+	handle := cmd.Handle
+
+	cmd.Handle = func(c *cobra.Command, args []string) (err error) {
+		ctx := c.Context()
+
+		defer runCleanup(ctx)
+		defer func() {
+			r := recover()
+
+			if r == nil {
+				return
+			}
+
+			panicked := handlerPanicked(c, r)
+			l := LoggerFromContext(ctx)
+			l.Error().Str("command", panicked.Command).Str("panic", panicMessage(r)).Str("stack", string(panicked.Stack)).Msg("command panicked")
+
+			err = panicked
+		}()
+
+		return handle(c, args)
+	}
+
+	return cmd
+}
@@ -0,0 +1,120 @@
+package clapp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_RecoversPanics(t *testing.T) {
+	calls := []string{}
+	tests := []struct {
+		name     string
+		handle   HandlerFunc
+		err      error
+		panics   bool
+		expected []string
+	}{
+		{
+			name: "panics are returned as errors after cleanup",
+			handle: func(cmd *cobra.Command, args []string) error {
+				OnCleanup(cmd.Context(), func(ctx context.Context) {
+					calls = append(calls, "handler")
+				})
+
+				panic("oh no")
+			},
+			panics:   true,
+			expected: []string{"handler", "app-2", "app-1"},
+		},
+		{
+			name: "cleanup runs when the handler succeeds",
+			handle: func(cmd *cobra.Command, args []string) error {
+				OnCleanup(cmd.Context(), func(ctx context.Context) {
+					calls = append(calls, "handler")
+				})
+
+				return nil
+			},
+			expected: []string{"handler", "app-2", "app-1"},
+		},
+		{
+			name: "cleanup runs when the handler fails",
+			handle: func(cmd *cobra.Command, args []string) error {
+				return ErrHandleError
+			},
+			err:      ErrHandleError,
+			expected: []string{"app-2", "app-1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			calls = []string{}
+			logs := &bytes.Buffer{}
+
+			err := Run(App{
+				Config:  &testConf{},
+				Fs:      afero.NewMemMapFs(),
+				Args:    []string{"child"},
+				Environ: Environ{},
+				Logger:  zerolog.New(logs),
+				Cleanup: []CleanupFunc{
+					func(ctx context.Context) {
+						calls = append(calls, "app-1")
+					},
+					func(ctx context.Context) {
+						calls = append(calls, "app-2")
+					},
+				},
+				RootCommand: Command{
+					Name: "panicky",
+					CustomConfiguration: func(cmd *cobra.Command) {
+						cmd.SetErr(&bytes.Buffer{})
+					},
+					Children: []Command{
+						{
+							Name:   "child",
+							Handle: test.handle,
+						},
+					},
+				},
+			}, NewCobraExecutor())
+
+			assert.Equal(tt, test.expected, calls)
+
+			if test.err != nil {
+				assert.Equal(tt, test.err, err)
+				return
+			}
+
+			if !test.panics {
+				assert.Nil(tt, err)
+				return
+			}
+
+			var panicked ErrHandlerPanicked
+			assert.True(tt, errors.As(err, &panicked))
+			assert.Equal(tt, "panicky child", panicked.Command)
+			assert.Equal(tt, "oh no", panicked.Value)
+			assert.Equal(tt, PanicExitCode, ExitCode(err))
+			assert.Contains(tt, logs.String(), `"command":"panicky child"`)
+			assert.Contains(tt, logs.String(), `"panic":"oh no"`)
+			assert.Contains(tt, logs.String(), `"stack":"goroutine`)
+			assert.Contains(tt, logs.String(), `"message":"command panicked"`)
+		})
+	}
+}
+
+func TestOnCleanup_WithoutHooksInContext(t *testing.T) {
+	assert.NotPanics(t, func() {
+		OnCleanup(context.Background(), func(ctx context.Context) {})
+		runCleanup(context.Background())
+	})
+}
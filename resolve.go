@@ -0,0 +1,265 @@
+package clapp
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// Resolver turns a reference found in a config value, such as
+// file:///run/secrets/db_password, into the value it points at.
+type Resolver interface {
+	Scheme() string
+	Resolve(ref string) (string, error)
+}
+
+// FileResolver reads the referenced file, without any trailing newline, e.g.
+// file:///run/secrets/db_password
+type FileResolver struct {
+	Fs afero.Fs
+}
+
+func (r FileResolver) Scheme() string {
+	return "file"
+}
+
+func (r FileResolver) Resolve(ref string) (string, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(ref, "file:"), "//")
+
+	b, err := afero.ReadFile(r.Fs, path)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// EnvResolver reads the referenced environment variable e.g. env:DB_PASSWORD
+type EnvResolver struct {
+	Lookup func(key string) (string, bool)
+}
+
+func (r EnvResolver) Scheme() string {
+	return "env"
+}
+
+func (r EnvResolver) Resolve(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, "env:")
+
+	if v, ok := r.Lookup(name); ok {
+		return v, nil
+	}
+
+	return "", fmt.Errorf("environment variable %s is not set", name)
+}
+
+// expandEnv expands ${VAR}, ${VAR:-default} and ${VAR-default} in s, $$ can
+// be used for a literal $.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		if s[i+1] != '{' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+
+		if end == -1 {
+			return "", ErrUnresolvedReference{
+				Ref:     s[i:],
+				wrapped: fmt.Errorf("missing closing brace"),
+			}
+		}
+
+		expr := s[i+2 : i+end]
+		v, err := expandExpr(expr, lookup)
+
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(v)
+		i += end
+	}
+
+	return b.String(), nil
+}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// expandExpr expands the inside of ${...}, only the operator directly after
+// the variable's name is used so defaults may contain - or :-.
+func expandExpr(expr string, lookup func(string) (string, bool)) (string, error) {
+	name := envNameRegexp.FindString(expr)
+	op := expr[len(name):]
+
+	switch {
+	case name != "" && strings.HasPrefix(op, ":-"):
+		if v, ok := lookup(name); ok && v != "" {
+			return v, nil
+		}
+
+		return op[2:], nil
+	case name != "" && strings.HasPrefix(op, "-"):
+		if v, ok := lookup(name); ok {
+			return v, nil
+		}
+
+		return op[1:], nil
+	case name == "" || op != "":
+		return "", ErrUnresolvedReference{
+			Ref:     fmt.Sprintf("${%s}", expr),
+			wrapped: fmt.Errorf("invalid variable name %q", expr),
+		}
+	}
+
+	if v, ok := lookup(name); ok {
+		return v, nil
+	}
+
+	return "", ErrUnresolvedReference{
+		Ref:     fmt.Sprintf("${%s}", expr),
+		wrapped: fmt.Errorf("environment variable %s is not set", name),
+	}
+}
+
+func expandNode(n *yaml.Node, lookup func(string) (string, bool)) error {
+	if n.Kind == yaml.ScalarNode {
+		v, err := expandEnv(n.Value, lookup)
+
+		if err != nil {
+			return err
+		}
+
+		if v != n.Value {
+			n.Value = v
+
+			// plain scalars need their type resolving again e.g. port: ${PORT}
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+		}
+
+		return nil
+	}
+
+	for i, c := range n.Content {
+		// keys in a mapping are left alone
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+
+		if err := expandNode(c, lookup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolveRef(s string, resolvers []Resolver) (string, error) {
+	for _, r := range resolvers {
+		if !strings.HasPrefix(s, fmt.Sprintf("%s:", r.Scheme())) {
+			continue
+		}
+
+		v, err := r.Resolve(s)
+
+		if err != nil {
+			return "", ErrUnresolvedReference{
+				Ref:     s,
+				wrapped: err,
+			}
+		}
+
+		return v, nil
+	}
+
+	return s, nil
+}
+
+// resolveRefs replaces any string value in cfg that starts with the scheme of
+// one of the resolvers with the resolved value.
+func resolveRefs(v reflect.Value, resolvers []Resolver) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return resolveRefs(v.Elem(), resolvers)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+
+			if err := resolveRefs(v.Field(i), resolvers); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveRefs(v.Index(i), resolvers); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+
+		for _, k := range v.MapKeys() {
+			resolved, err := resolveRef(v.MapIndex(k).String(), resolvers)
+
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(k, reflect.ValueOf(resolved).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+
+		resolved, err := resolveRef(v.String(), resolvers)
+
+		if err != nil {
+			return err
+		}
+
+		v.SetString(resolved)
+	}
+
+	return nil
+}
+
+func defaultResolvers(fs afero.Fs, lookup func(string) (string, bool)) []Resolver {
+	return []Resolver{
+		FileResolver{
+			Fs: fs,
+		},
+		EnvResolver{
+			Lookup: lookup,
+		},
+	}
+}
@@ -0,0 +1,249 @@
+package clapp
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func mapLookup(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	lookup := mapLookup(map[string]string{
+		"HOST":  "db.internal",
+		"EMPTY": "",
+	})
+
+	tests := []struct {
+		input       string
+		expected    string
+		expectedErr error
+	}{
+		{input: "plain", expected: "plain"},
+		{input: "${HOST}", expected: "db.internal"},
+		{input: "tcp://${HOST}:5432", expected: "tcp://db.internal:5432"},
+		{input: "${MISSING:-localhost}", expected: "localhost"},
+		{input: "${EMPTY:-localhost}", expected: "localhost"},
+		{input: "${EMPTY-localhost}", expected: ""},
+		{input: "${MISSING-localhost}", expected: "localhost"},
+		{input: "cost: $$5 $HOST", expected: "cost: $5 $HOST"},
+		{input: "${MISSING:-a-b}", expected: "a-b"},
+		{input: "${MISSING-a:-b}", expected: "a:-b"},
+		{input: "${HOST-a:-b}", expected: "db.internal"},
+		{input: "${EMPTY-a:-b}", expected: ""},
+		{input: "${MY-HOST}", expected: "HOST"},
+		{
+			input: "${HO.ST}",
+			expectedErr: ErrUnresolvedReference{
+				Ref:     "${HO.ST}",
+				wrapped: errors.New(`invalid variable name "HO.ST"`),
+			},
+		},
+		{
+			input: "${:-localhost}",
+			expectedErr: ErrUnresolvedReference{
+				Ref:     "${:-localhost}",
+				wrapped: errors.New(`invalid variable name ":-localhost"`),
+			},
+		},
+		{
+			input: "${MISSING}",
+			expectedErr: ErrUnresolvedReference{
+				Ref:     "${MISSING}",
+				wrapped: errors.New("environment variable MISSING is not set"),
+			},
+		},
+		{
+			input: "${HOST",
+			expectedErr: ErrUnresolvedReference{
+				Ref:     "${HOST",
+				wrapped: errors.New("missing closing brace"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(tt *testing.T) {
+			v, err := expandEnv(test.input, lookup)
+
+			assert.Equal(tt, test.expectedErr, err)
+			assert.Equal(tt, test.expected, v)
+		})
+	}
+}
+
+func TestExpandNode(t *testing.T) {
+	raw := []byte(`# ${NOT_EXPANDED}
+should-enable-this: ${FEATURE}
+external-endpoint:
+  domain: "${DOMAIN:-localhost}"
+  port: ${PORT}
+list-of-things:
+  - ${FEATURE}
+`)
+
+	doc := yaml.Node{}
+	assert.Nil(t, yaml.Unmarshal(raw, &doc))
+	assert.Nil(t, expandNode(&doc, mapLookup(map[string]string{
+		"FEATURE": "on",
+		"PORT":    "8080",
+	})))
+
+	cfg := &testConf{}
+	c := &Config{}
+	assert.Nil(t, c.decode(&doc, cfg))
+	assert.Equal(t, testConf{
+		ShouldEnableThis: "on",
+		ExternalEndpoint: testExtEndpoint{
+			Domain: "localhost",
+			Port:   8080,
+		},
+		ListOfThings: []string{"on"},
+	}, *cfg)
+
+	doc = yaml.Node{}
+	assert.Nil(t, yaml.Unmarshal(raw, &doc))
+	assert.IsType(t, ErrUnresolvedReference{}, expandNode(&doc, mapLookup(map[string]string{})))
+}
+
+func TestResolvers(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/run/secrets/db_password", []byte("hunter2\n"), 0600))
+
+	f := FileResolver{Fs: fs}
+	assert.Equal(t, "file", f.Scheme())
+
+	v, err := f.Resolve("file:///run/secrets/db_password")
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", v)
+
+	_, err = f.Resolve("file:///run/secrets/missing")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	e := EnvResolver{Lookup: mapLookup(map[string]string{"DB_PASSWORD": "swordfish"})}
+	assert.Equal(t, "env", e.Scheme())
+
+	v, err = e.Resolve("env:DB_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "swordfish", v)
+
+	_, err = e.Resolve("env:MISSING")
+	assert.Equal(t, errors.New("environment variable MISSING is not set"), err)
+}
+
+func TestResolveRefs(t *testing.T) {
+	resolvers := []Resolver{
+		EnvResolver{Lookup: mapLookup(map[string]string{"A": "resolved-a", "B": "resolved-b"})},
+	}
+
+	cfg := &struct {
+		Plain    string
+		Ref      string
+		List     []string
+		Map      map[string]string
+		Nested   testExtEndpoint
+		Pointer  *testExtEndpoint
+		internal string
+	}{
+		Plain:    "https://not-a-ref",
+		Ref:      "env:A",
+		List:     []string{"env:B", "other"},
+		Map:      map[string]string{"key": "env:A"},
+		Nested:   testExtEndpoint{Domain: "env:B"},
+		internal: "env:A",
+	}
+
+	assert.Nil(t, resolveRefs(reflect.ValueOf(cfg), resolvers))
+	assert.Equal(t, "https://not-a-ref", cfg.Plain)
+	assert.Equal(t, "resolved-a", cfg.Ref)
+	assert.Equal(t, []string{"resolved-b", "other"}, cfg.List)
+	assert.Equal(t, map[string]string{"key": "resolved-a"}, cfg.Map)
+	assert.Equal(t, "resolved-b", cfg.Nested.Domain)
+	assert.Nil(t, cfg.Pointer)
+	assert.Equal(t, "env:A", cfg.internal)
+
+	cfg.Ref = "env:MISSING"
+	err := resolveRefs(reflect.ValueOf(cfg), resolvers)
+	assert.Equal(t, ErrUnresolvedReference{
+		Ref:     "env:MISSING",
+		wrapped: errors.New("environment variable MISSING is not set"),
+	}, err)
+	assert.Equal(t, "could not resolve env:MISSING in config: environment variable MISSING is not set", err.Error())
+}
+
+func TestConfig_load_ResolvesReferences(t *testing.T) {
+	fs := buildMockFs()
+	ctx := contextStub{
+		Vals: map[interface{}]interface{}{
+			FsContextKey: fs,
+		},
+	}
+
+	assert.Nil(t, afero.WriteFile(fs, "/run/secrets/domain", []byte("secret.example.com\n"), 0600))
+	assert.Nil(t, afero.WriteFile(fs, "/refs.yaml", []byte(`should-enable-this: ${RESOLVE_TEST_FEATURE:-fallback}
+external-endpoint:
+  domain: file:///run/secrets/domain
+`), 0644))
+
+	cfg := &testConf{}
+	_, err := newConfigManager(ctx, cfg, "blah", "/refs.yaml", true, ResolveReferencesOpt())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fallback", cfg.ShouldEnableThis)
+	assert.Equal(t, "secret.example.com", cfg.ExternalEndpoint.Domain)
+}
+
+func TestConfig_load_ExpandedErrorsUseFilePositions(t *testing.T) {
+	fs := buildMockFs()
+	ctx := contextStub{
+		Vals: map[interface{}]interface{}{
+			FsContextKey: fs,
+		},
+	}
+
+	assert.Nil(t, afero.WriteFile(fs, "/refs.yaml", []byte(`# the endpoint
+
+external-endpoint: {domain: "${RESOLVE_TEST_DOMAIN:-localhost}",   port: "${RESOLVE_TEST_PORT:-not-a-port}"}
+
+nope: true
+`), 0644))
+
+	tests := []struct {
+		name     string
+		opts     []configOpt
+		expected string
+	}{
+		{
+			name:     "type errors",
+			opts:     []configOpt{ResolveReferencesOpt()},
+			expected: "line 3: cannot unmarshal !!str `not-a-port` into int",
+		},
+		{
+			name: "type errors and unknown keys",
+			opts: []configOpt{ResolveReferencesOpt(), StrictOpt()},
+			expected: "line 3: cannot unmarshal !!str `not-a-port` into int\n  " +
+				"line 5: field nope not found in type clapp.testConf",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			_, err := newConfigManager(ctx, &testConf{}, "blah", "/refs.yaml", true, test.opts...)
+
+			unmarshalErr := ErrUnmarshallingYAML{}
+			assert.True(tt, errors.As(err, &unmarshalErr))
+			assert.Equal(tt, 3, unmarshalErr.Line)
+			assert.Contains(tt, err.Error(), test.expected)
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package clapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const jsonSchemaDraft string = "http://json-schema.org/draft-07/schema#"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// JSONSchema is the subset of draft-07 JSON schema that can be derived from a
+// config struct.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+}
+
+func (s *JSONSchema) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s)
+}
+
+func (s *JSONSchema) propertyNames() []string {
+	names := []string{}
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// NewConfigSchema derives a JSON schema from the yaml tags, types and defaults
+// of the config struct. Fields tagged with required:"true" are marked as
+// required and desc tags are used as descriptions. Defaults come from default
+// tags and the values in cfg, so it should be given the config before it is
+// loaded.
+func NewConfigSchema(cfg interface{}) (*JSONSchema, error) {
+	rval := reflect.ValueOf(cfg)
+
+	if rval.Kind() != reflect.Ptr {
+		return nil, ErrConfigMustBeAPointer
+	}
+
+	rval = rval.Elem()
+	if rval.Kind() != reflect.Struct {
+		return nil, ErrConfigMustPointToAStruct
+	}
+
+	s := schemaForStruct(rval.Type(), rval)
+	s.Schema = jsonSchemaDraft
+
+	return s, nil
+}
+
+func schemaForStruct(t reflect.Type, v reflect.Value) *JSONSchema {
+	s := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name, inline, skip := yamlName(sf)
+
+		if skip {
+			continue
+		}
+
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+
+		if inline {
+			ft, fv := derefType(sf.Type, fv)
+
+			if ft.Kind() == reflect.Struct {
+				inner := schemaForStruct(ft, fv)
+
+				for k, p := range inner.Properties {
+					s.Properties[k] = p
+				}
+
+				s.Required = append(s.Required, inner.Required...)
+			}
+
+			continue
+		}
+
+		prop := schemaForType(sf.Type, fv)
+		prop.Description = sf.Tag.Get("desc")
+
+		if def := sf.Tag.Get("default"); def != "" {
+			prop.Default = typedDefault(prop.Type, def)
+		}
+
+		if prop.Default != nil && isSecretField(sf.Type, sf.Tag) {
+			prop.Default = SecretMask
+		}
+
+		s.Properties[name] = prop
+
+		if isTrue(sf.Tag.Get("required")) {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	sort.Strings(s.Required)
+
+	return s
+}
+
+func derefType(t reflect.Type, v reflect.Value) (reflect.Type, reflect.Value) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+
+		if v.IsValid() {
+			if v.IsNil() {
+				v = reflect.Value{}
+			} else {
+				v = v.Elem()
+			}
+		}
+	}
+
+	return t, v
+}
+
+func schemaForType(t reflect.Type, v reflect.Value) *JSONSchema {
+	t, v = derefType(t, v)
+
+	s := &JSONSchema{}
+
+	switch {
+	case t == durationType:
+		s.Type = "string"
+		s.Format = "duration"
+	case t == timeType:
+		s.Type = "string"
+		s.Format = "date-time"
+	case t.Kind() == reflect.Struct && isLeafStruct(t):
+		s.Type = "string"
+	case t.Kind() == reflect.Struct:
+		return schemaForStruct(t, v)
+	case t.Kind() == reflect.String:
+		s.Type = "string"
+	case t.Kind() == reflect.Bool:
+		s.Type = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s.Type = "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s.Type = "number"
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		s.Type = "string"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s.Type = "array"
+		s.Items = schemaForType(t.Elem(), reflect.Value{})
+	case t.Kind() == reflect.Map:
+		s.Type = "object"
+		s.AdditionalProperties = schemaForType(t.Elem(), reflect.Value{})
+	}
+
+	if v.IsValid() && !v.IsZero() && s.Type != "" && s.Type != "object" {
+		s.Default = schemaDefault(v)
+	}
+
+	return s
+}
+
+func schemaDefault(v reflect.Value) interface{} {
+	switch val := v.Interface().(type) {
+	case time.Duration:
+		return val.String()
+	case json.Marshaler:
+		return val
+	case fmt.Stringer:
+		if v.Kind() == reflect.Struct {
+			return val.String()
+		}
+	}
+
+	return v.Interface()
+}
+
+func typedDefault(schemaType string, def string) interface{} {
+	switch schemaType {
+	case "integer":
+		if i, err := strconv.ParseInt(def, 0, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(def, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(def); err == nil {
+			return b
+		}
+	case "array":
+		return strings.Split(def, ",")
+	}
+
+	return def
+}
+
+type SchemaViolation struct {
+	Path    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	return fmt.Sprintf("line %d, column %d: %s: %s", v.Line, v.Column, v.Path, v.Message)
+}
+
+// ValidateConfigYAML checks raw yaml against a schema produced by
+// NewConfigSchema, reporting unknown keys and values of the wrong type.
+func ValidateConfigYAML(schema *JSONSchema, raw []byte) error {
+	doc := yaml.Node{}
+
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return newErrUnmarshallingYAML(err)
+	}
+
+	return validateDocument(schema, &doc)
+}
+
+func validateDocument(schema *JSONSchema, doc *yaml.Node) error {
+	// an empty file is considered valid
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	violations := validateNode(schema, doc.Content[0], "")
+
+	if len(violations) > 0 {
+		return ErrConfigSchemaViolations{
+			Violations: violations,
+		}
+	}
+
+	return nil
+}
+
+func joinSchemaPath(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+
+	return fmt.Sprintf("%s.%s", parent, key)
+}
+
+func nodeMatchesType(schemaType string, n *yaml.Node) bool {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" {
+		return true
+	}
+
+	switch schemaType {
+	case "object":
+		return n.Kind == yaml.MappingNode
+	case "array":
+		return n.Kind == yaml.SequenceNode
+	case "string":
+		return n.Kind == yaml.ScalarNode
+	case "boolean":
+		return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!bool"
+	case "integer":
+		return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!int"
+	case "number":
+		return n.Kind == yaml.ScalarNode && (n.ShortTag() == "!!int" || n.ShortTag() == "!!float")
+	}
+
+	return true
+}
+
+func validateNode(s *JSONSchema, n *yaml.Node, path string) []SchemaViolation {
+	violations := []SchemaViolation{}
+
+	if s == nil {
+		return violations
+	}
+
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	if s.Type != "" && !nodeMatchesType(s.Type, n) {
+		return append(violations, SchemaViolation{
+			Path:    path,
+			Line:    n.Line,
+			Column:  n.Column,
+			Message: fmt.Sprintf("expected %s", s.Type),
+		})
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			keyPath := joinSchemaPath(path, k.Value)
+
+			// yaml merge keys are resolved by the decoder
+			if k.Value == "<<" {
+				continue
+			}
+
+			if prop, ok := s.Properties[k.Value]; ok {
+				violations = append(violations, validateNode(prop, v, keyPath)...)
+				continue
+			}
+
+			switch additional := s.AdditionalProperties.(type) {
+			case *JSONSchema:
+				violations = append(violations, validateNode(additional, v, keyPath)...)
+			case bool:
+				if !additional {
+					violations = append(violations, SchemaViolation{
+						Path:    keyPath,
+						Line:    k.Line,
+						Column:  k.Column,
+						Message: "unknown key" + didYouMean(Suggest(k.Value, s.propertyNames()), strconv.Quote),
+					})
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			violations = append(violations, validateNode(s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,144 @@
+package clapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSchemaConf struct {
+	Name     string            `yaml:"name" required:"true" desc:"the name of the thing"`
+	Port     int               `yaml:"port" default:"8080"`
+	Ratio    float64           `yaml:"ratio"`
+	Enabled  bool              `yaml:"enabled"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Tags     []string          `yaml:"tags"`
+	Labels   map[string]string `yaml:"labels"`
+	Endpoint *testExtEndpoint  `yaml:"endpoint"`
+	Skipped  string            `yaml:"-"`
+}
+
+func TestNewConfigSchema(t *testing.T) {
+	s, err := NewConfigSchema(&testSchemaConf{
+		Timeout: 5 * time.Second,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, jsonSchemaDraft, s.Schema)
+	assert.Equal(t, "object", s.Type)
+	assert.Equal(t, false, s.AdditionalProperties)
+	assert.Equal(t, []string{"name"}, s.Required)
+	assert.Len(t, s.Properties, 8)
+
+	assert.Equal(t, &JSONSchema{Type: "string", Description: "the name of the thing"}, s.Properties["name"])
+	assert.Equal(t, &JSONSchema{Type: "integer", Default: int64(8080)}, s.Properties["port"])
+	assert.Equal(t, &JSONSchema{Type: "number"}, s.Properties["ratio"])
+	assert.Equal(t, &JSONSchema{Type: "boolean"}, s.Properties["enabled"])
+	assert.Equal(t, &JSONSchema{Type: "string", Format: "duration", Default: "5s"}, s.Properties["timeout"])
+	assert.Equal(t, &JSONSchema{Type: "array", Items: &JSONSchema{Type: "string"}}, s.Properties["tags"])
+	assert.Equal(t, &JSONSchema{Type: "object", AdditionalProperties: &JSONSchema{Type: "string"}}, s.Properties["labels"])
+	assert.Equal(t, "object", s.Properties["endpoint"].Type)
+	assert.Len(t, s.Properties["endpoint"].Properties, 3)
+}
+
+func TestNewConfigSchema_Errors(t *testing.T) {
+	_, err := NewConfigSchema(testSchemaConf{})
+	assert.Equal(t, ErrConfigMustBeAPointer, err)
+
+	_, err = NewConfigSchema(&[]string{})
+	assert.Equal(t, ErrConfigMustPointToAStruct, err)
+}
+
+func TestJSONSchema_WriteJSON(t *testing.T) {
+	s, err := NewConfigSchema(&testSchemaConf{})
+	assert.Nil(t, err)
+
+	b := new(bytes.Buffer)
+	assert.Nil(t, s.WriteJSON(b))
+
+	decoded := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(b.Bytes(), &decoded))
+	assert.Equal(t, jsonSchemaDraft, decoded["$schema"])
+	assert.Equal(t, false, decoded["additionalProperties"])
+}
+
+func TestValidateConfigYAML(t *testing.T) {
+	s, err := NewConfigSchema(&testSchemaConf{})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name               string
+		raw                string
+		expectedViolations []SchemaViolation
+	}{
+		{
+			name: "valid yaml",
+			raw: `name: blah
+port: 80
+ratio: 1
+enabled: true
+timeout: 5s
+tags: [a, b]
+labels:
+  anything: goes
+endpoint:
+  protocol: https
+`,
+		},
+		{
+			name: "empty yaml",
+			raw:  "",
+		},
+		{
+			name: "unknown keys are reported",
+			raw: `name: blah
+nmae: blah
+endpoint:
+  protocl: https
+`,
+			expectedViolations: []SchemaViolation{
+				{Path: "nmae", Line: 2, Column: 1, Message: `unknown key, did you mean "name"?`},
+				{Path: "endpoint.protocl", Line: 4, Column: 3, Message: `unknown key, did you mean "protocol"?`},
+			},
+		},
+		{
+			name: "types are checked",
+			raw: `port: eighty
+enabled: "yes please"
+tags:
+  - a
+  - [b]
+`,
+			expectedViolations: []SchemaViolation{
+				{Path: "port", Line: 1, Column: 7, Message: "expected integer"},
+				{Path: "enabled", Line: 2, Column: 10, Message: "expected boolean"},
+				{Path: "tags[1]", Line: 5, Column: 5, Message: "expected string"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			err := ValidateConfigYAML(s, []byte(test.raw))
+
+			if len(test.expectedViolations) == 0 {
+				assert.Nil(tt, err)
+				return
+			}
+
+			assert.Equal(tt, ErrConfigSchemaViolations{
+				Violations: test.expectedViolations,
+			}, err)
+		})
+	}
+}
+
+func TestValidateConfigYAML_InvalidYAML(t *testing.T) {
+	s, err := NewConfigSchema(&testSchemaConf{})
+	assert.Nil(t, err)
+
+	assert.IsType(t, ErrUnmarshallingYAML{}, ValidateConfigYAML(s, []byte(aintValidYAML)))
+}
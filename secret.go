@@ -0,0 +1,293 @@
+package clapp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretMask replaces the value of secrets wherever clapp outputs them.
+const SecretMask string = "******"
+
+const secretFlagAnnotation string = "clapp_secret"
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Secret is a string that masks itself when it is formatted or marshalled,
+// use Value to get at the real value.
+type Secret string
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return maskSecret(string(s))
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+func (s Secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", s.String())), nil
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// maskSecret masks non-empty values, an empty value is left as it is so it
+// is still clear that nothing was set.
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return SecretMask
+}
+
+// isSecretField reports whether a field is marked with secret:"true" or
+// clapp:"secret", or is of the Secret type.
+func isSecretField(t reflect.Type, tag reflect.StructTag) bool {
+	if t == secretType || isTrue(tag.Get("secret")) {
+		return true
+	}
+
+	for _, opt := range strings.Split(tag.Get("clapp"), ",") {
+		if strings.TrimSpace(opt) == "secret" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f configField) Secret() bool {
+	return isSecretField(f.Type, f.Tag)
+}
+
+func secretFields(cfg interface{}) []configField {
+	fields, err := collectConfigFields(cfg, "")
+
+	if err != nil {
+		return nil
+	}
+
+	secrets := []configField{}
+	for _, f := range fields {
+		if f.Secret() {
+			secrets = append(secrets, f)
+		}
+	}
+
+	return secrets
+}
+
+func findYAMLNode(n *yaml.Node, path []string) *yaml.Node {
+	if n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil
+		}
+
+		n = n.Content[0]
+	}
+
+	for _, key := range path {
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		n = next
+	}
+
+	return n
+}
+
+// DumpConfig writes the config as yaml, with the value of every secret field
+// replaced with SecretMask.
+func DumpConfig(w io.Writer, cfg interface{}) error {
+	doc := yaml.Node{}
+
+	if err := doc.Encode(cfg); err != nil {
+		return err
+	}
+
+	for _, f := range secretFields(cfg) {
+		if n := findYAMLNode(&doc, f.YAMLPath); n != nil && n.Value != "" {
+			n.Kind = yaml.ScalarNode
+			n.Tag = "!!str"
+			n.Value = SecretMask
+			n.Content = nil
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+
+	return enc.Encode(&doc)
+}
+
+// redactYAMLError removes the values of secret fields from a yaml error, as
+// the yaml library includes the offending value in its messages.
+func redactYAMLError(err error, doc *yaml.Node, cfg interface{}) error {
+	msg := err.Error()
+
+	for _, f := range secretFields(cfg) {
+		n := findYAMLNode(doc, f.YAMLPath)
+
+		if n == nil || n.Kind != yaml.ScalarNode || n.Value == "" {
+			continue
+		}
+
+		msg = strings.ReplaceAll(msg, yamlQuotedValue(n.Value), "`"+SecretMask+"`")
+	}
+
+	if msg == err.Error() {
+		return err
+	}
+
+	return errors.New(msg)
+}
+
+// yamlQuotedValue is value as the yaml library quotes it in errors, long
+// values are cut short.
+func yamlQuotedValue(value string) string {
+	if len(value) > 10 {
+		return "`" + value[:7] + "...`"
+	}
+
+	return "`" + value + "`"
+}
+
+// redactEnvError masks the value in envconfig's errors when it was for a
+// secret field.
+func redactEnvError(err error, cfg interface{}, prefix string, naming EnvNaming) error {
+	parseErr, ok := err.(*envconfig.ParseError)
+
+	if !ok {
+		return err
+	}
+
+	fields, fErr := collectEnvConfigFields(cfg, prefix, naming)
+
+	if fErr != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if f.Secret() && (f.EnvVar == parseErr.KeyName || f.EnvAlt == parseErr.KeyName) {
+			redacted := *parseErr
+			redacted.Value = SecretMask
+			redacted.Err = errors.New(strings.ReplaceAll(parseErr.Err.Error(), parseErr.Value, SecretMask))
+
+			return &redacted
+		}
+	}
+
+	return err
+}
+
+// maskSecrets returns a copy of v with the secret fields of any struct in it
+// masked, as DumpConfig masks them. Secrets that aren't strings can't hold
+// SecretMask, so they are left at their zero value.
+func maskSecrets(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+
+	if !rv.IsValid() {
+		return v
+	}
+
+	return maskedValue(rv).Interface()
+}
+
+func maskedValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+
+		if v.Kind() == reflect.Interface {
+			cp := reflect.New(v.Type()).Elem()
+			cp.Set(maskedValue(v.Elem()))
+
+			return cp
+		}
+
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(maskedValue(v.Elem()))
+
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+
+			switch {
+			case f.PkgPath != "":
+				continue
+			case !isSecretField(f.Type, f.Tag):
+				cp.Field(i).Set(maskedValue(v.Field(i)))
+			case v.Field(i).IsZero():
+				// left empty so it is still clear that nothing was set
+			case f.Type.Kind() == reflect.String:
+				cp.Field(i).SetString(SecretMask)
+			default:
+				cp.Field(i).Set(reflect.Zero(f.Type))
+			}
+		}
+
+		return cp
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v
+		}
+
+		cp := reflect.New(v.Type()).Elem()
+		if v.Kind() == reflect.Slice {
+			cp = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(maskedValue(v.Index(i)))
+		}
+
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			cp.SetMapIndex(k, maskedValue(v.MapIndex(k)))
+		}
+
+		return cp
+	}
+
+	return v
+}
@@ -0,0 +1,153 @@
+package clapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type testSecretConf struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+	Token    Secret `yaml:"token"`
+	Database struct {
+		Port int    `yaml:"port" clapp:"secret"`
+		DSN  string `yaml:"dsn" clapp:"other,secret"`
+	} `yaml:"database"`
+}
+
+func TestSecret(t *testing.T) {
+	s := Secret("hunter2")
+
+	assert.Equal(t, "hunter2", s.Value())
+	assert.Equal(t, SecretMask, s.String())
+	assert.Equal(t, SecretMask, fmt.Sprintf("%s", s))
+	assert.Equal(t, SecretMask, fmt.Sprintf("%v", s))
+	assert.Equal(t, SecretMask, fmt.Sprintf("%+v", s))
+	assert.Equal(t, SecretMask, fmt.Sprintf("%x", s))
+	assert.Equal(t, fmt.Sprintf("{%s}", SecretMask), fmt.Sprintf("%v", struct{ S Secret }{s}))
+	assert.Equal(t, `"******"`, s.GoString())
+
+	j, err := json.Marshal(struct{ S Secret }{s})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"S":"******"}`, string(j))
+
+	y, err := yaml.Marshal(struct{ S Secret }{s})
+	assert.Nil(t, err)
+	assert.Equal(t, "s: '******'\n", string(y))
+
+	assert.Equal(t, "", Secret("").String())
+
+	// secrets can still be decoded
+	decoded := struct {
+		S Secret `yaml:"s"`
+	}{}
+	assert.Nil(t, yaml.Unmarshal([]byte("s: swordfish"), &decoded))
+	assert.Equal(t, "swordfish", decoded.S.Value())
+}
+
+func TestSecretFields(t *testing.T) {
+	names := []string{}
+	for _, f := range secretFields(&testSecretConf{}) {
+		names = append(names, f.Name())
+	}
+
+	assert.Equal(t, []string{"Password", "Token", "Database.Port", "Database.DSN"}, names)
+	assert.Nil(t, secretFields(testSecretConf{}))
+}
+
+func TestDumpConfig(t *testing.T) {
+	cfg := &testSecretConf{
+		Username: "admin",
+		Password: "hunter2",
+		Token:    "abc123",
+	}
+	cfg.Database.Port = 5432
+
+	b := new(bytes.Buffer)
+	assert.Nil(t, DumpConfig(b, cfg))
+
+	assert.Equal(t, `username: admin
+password: '******'
+token: '******'
+database:
+    port: '******'
+    dsn: ""
+`, b.String())
+}
+
+func TestConfig_load_RedactsSecretsFromErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   string
+		secret string
+	}{
+		{
+			name:   "secret values",
+			port:   "hunter2",
+			secret: "hunter2",
+		},
+		{
+			name:   "long values cut short by yaml",
+			port:   "hunter2hunter2",
+			secret: "hunter2",
+		},
+		{
+			name:   "short values found elsewhere in the message",
+			port:   "e",
+			secret: "`e`",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			fs := afero.NewMemMapFs()
+			assert.Nil(tt, afero.WriteFile(fs, "/secret.yaml", []byte(`username: [admin]
+database:
+  port: `+test.port+`
+`), 0644))
+
+			ctx := contextStub{
+				Vals: map[interface{}]interface{}{
+					FsContextKey: fs,
+				},
+			}
+
+			_, err := newConfigManager(ctx, &testSecretConf{}, "blah", "/secret.yaml", true)
+
+			assert.NotNil(tt, err)
+			assert.NotContains(tt, err.Error(), test.secret)
+			assert.Contains(tt, err.Error(), "line 1: cannot unmarshal !!seq into string")
+			assert.Contains(tt, err.Error(), "line 3: cannot unmarshal !!str `******` into int")
+		})
+	}
+}
+
+func TestConfig_OverrideWithEnvVars_RedactsSecretsFromErrors(t *testing.T) {
+	ctx := contextStub{
+		Vals: map[interface{}]interface{}{
+			FsContextKey: afero.NewMemMapFs(),
+		},
+	}
+
+	cfg, err := newConfigManager(ctx, &testSecretConf{}, "redact", "", false)
+	assert.Nil(t, err)
+
+	os.Setenv("REDACT_DATABASE_PORT", "hunter2")
+	defer os.Unsetenv("REDACT_DATABASE_PORT")
+
+	err = cfg.OverrideWithEnvVars(&testSecretConf{})
+
+	parseErr := &envconfig.ParseError{}
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, SecretMask, parseErr.Value)
+	assert.NotContains(t, err.Error(), "hunter2")
+}
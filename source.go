@@ -0,0 +1,285 @@
+package clapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// Source loads values into the config struct. Sources are run in order, so a
+// value set by a later source replaces one set by an earlier source. The
+// config manager is available to Load through ConfigManagerFromContext.
+type Source interface {
+	Name() string
+	Load(ctx context.Context, into interface{}) error
+}
+
+// DefaultSources are used when App.Sources is nil, the config file followed
+// by environment variables.
+func DefaultSources() []Source {
+	return []Source{
+		FileSource(),
+		EnvSource(),
+	}
+}
+
+// SourcesOpt sets the sources used by Run and Reload.
+func SourcesOpt(sources ...Source) configOpt {
+	return func(c *Config) {
+		c.sources = sources
+	}
+}
+
+type fileSource struct{}
+
+// FileSource loads the app's yaml config file, along with any includes and
+// profile overlay.
+func FileSource() Source {
+	return fileSource{}
+}
+
+func (s fileSource) Name() string {
+	return "file"
+}
+
+func (s fileSource) Load(ctx context.Context, into interface{}) error {
+	return ConfigManagerFromContext(ctx).load(into)
+}
+
+type envSource struct{}
+
+// EnvSource overrides the config with environment variables using the app's
+// name as the prefix.
+func EnvSource() Source {
+	return envSource{}
+}
+
+func (s envSource) Name() string {
+	return "env"
+}
+
+func (s envSource) Load(ctx context.Context, into interface{}) error {
+	if err := ConfigManagerFromContext(ctx).OverrideWithEnvVars(into); err != nil {
+		return ErrOverridingConfigWithEnvFailed{
+			wrapped: err,
+		}
+	}
+
+	return nil
+}
+
+// JSONFileSource loads a JSON file, such as a dump of the config from another
+// system. Keys are matched using the yaml tags of the config struct.
+type JSONFileSource struct {
+	Path      string
+	MustExist bool
+}
+
+func (s JSONFileSource) Name() string {
+	return fmt.Sprintf("json:%s", s.Path)
+}
+
+func (s JSONFileSource) Load(ctx context.Context, into interface{}) error {
+	ConfigManagerFromContext(ctx).trackFile(s.Path)
+
+	b, err := readConfigFile(FsFromContext(ctx), s.Path)
+
+	if _, notFound := err.(ErrConfigFileNotFound); notFound && !s.MustExist {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var raw interface{}
+
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return ErrLoadingSource{
+			Source:  s.Name(),
+			wrapped: err,
+		}
+	}
+
+	if raw == nil {
+		return nil
+	}
+
+	// round trip through yaml so the yaml tags are used for the keys
+	asYAML, err := yaml.Marshal(raw)
+
+	if err != nil {
+		return ErrLoadingSource{
+			Source:  s.Name(),
+			wrapped: err,
+		}
+	}
+
+	if err := yaml.Unmarshal(asYAML, into); err != nil {
+		return ErrLoadingSource{
+			Source:  s.Name(),
+			wrapped: err,
+		}
+	}
+
+	return nil
+}
+
+// ConfigMapSource loads a directory where each file holds a single value, as
+// when a Kubernetes ConfigMap or Secret is mounted as a volume. The file name
+// is the yaml key, dots in the name are used for nested keys e.g. a file
+// named external-endpoint.port. Hidden files, such as the ..data link that
+// Kubernetes creates, and sub directories are ignored.
+type ConfigMapSource struct {
+	Dir       string
+	MustExist bool
+}
+
+func (s ConfigMapSource) Name() string {
+	return fmt.Sprintf("configmap:%s", s.Dir)
+}
+
+func (s ConfigMapSource) Load(ctx context.Context, into interface{}) error {
+	fs := FsFromContext(ctx)
+	entries, err := afero.ReadDir(fs, s.Dir)
+
+	if err != nil {
+		if exists, _ := afero.DirExists(fs, s.Dir); !exists && !s.MustExist {
+			return nil
+		}
+
+		return ErrLoadingSource{
+			Source:  s.Name(),
+			wrapped: err,
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	root := &yaml.Node{
+		Kind: yaml.MappingNode,
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(s.Dir, e.Name())
+		ConfigManagerFromContext(ctx).trackFile(path)
+
+		b, err := afero.ReadFile(fs, path)
+
+		if err != nil {
+			return ErrLoadingSource{
+				Source:  s.Name(),
+				wrapped: err,
+			}
+		}
+
+		if err := setYAMLValue(root, strings.Split(e.Name(), "."), strings.TrimRight(string(b), "\r\n")); err != nil {
+			return ErrLoadingSource{
+				Source:  s.Name(),
+				wrapped: err,
+			}
+		}
+	}
+
+	if err := root.Decode(into); err != nil {
+		return ErrLoadingSource{
+			Source:  s.Name(),
+			wrapped: err,
+		}
+	}
+
+	return nil
+}
+
+// setYAMLValue sets a plain scalar at path in the mapping, creating any
+// mappings along the way. It is an error for a key on the path to hold a
+// scalar already, or for the value to replace a mapping.
+func setYAMLValue(n *yaml.Node, path []string, value string) error {
+	for i, key := range path {
+		var next *yaml.Node
+
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Value == key {
+				next = n.Content[j+1]
+				break
+			}
+		}
+
+		last := i == len(path)-1
+
+		switch {
+		case next == nil:
+			next = &yaml.Node{
+				Kind: yaml.MappingNode,
+			}
+
+			n.Content = append(n.Content, &yaml.Node{
+				Kind:  yaml.ScalarNode,
+				Value: key,
+			}, next)
+		case last && next.Kind == yaml.MappingNode && len(next.Content) > 0, !last && next.Kind == yaml.ScalarNode:
+			return ErrConflictingConfigKey{
+				Key:      strings.Join(path, "."),
+				Conflict: strings.Join(path[:i+1], "."),
+			}
+		}
+
+		if last {
+			next.Kind = yaml.ScalarNode
+			next.Value = value
+			next.Content = nil
+		}
+
+		n = next
+	}
+
+	return nil
+}
+
+func (c *Config) trackFile(path string) {
+	if c == nil || c.live == nil {
+		return
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+
+	c.live.files = append(c.live.files, path)
+}
+
+// runSources loads each source into the config in order. ctx is kept so the
+// sources can be run again when the config is reloaded.
+func (c *Config) runSources(ctx context.Context, into interface{}) error {
+	if ctx == nil {
+		ctx = contextWithFs(context.Background(), c.fs)
+	}
+
+	c.sourcesCtx = ctx
+	c.dotEnv = nil
+	ctx = contextWithConfigManager(ctx, c)
+
+	sources := c.sources
+	if sources == nil {
+		sources = DefaultSources()
+	}
+
+	for _, s := range sources {
+		if err := s.Load(ctx, into); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
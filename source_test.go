@@ -0,0 +1,263 @@
+package clapp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type funcSource struct {
+	name string
+	load func(into interface{}) error
+}
+
+func (s funcSource) Name() string {
+	return s.name
+}
+
+func (s funcSource) Load(ctx context.Context, into interface{}) error {
+	return s.load(into)
+}
+
+func TestRun_Sources(t *testing.T) {
+	fs := buildMockFs()
+	assert.Nil(t, afero.WriteFile(fs, "/dump.json", []byte(`{
+  "should-do-that": "from-json",
+  "external-endpoint": {"port": 9090},
+  "list-of-things": ["a", "b"]
+}`), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/should-enable-this", []byte("from-configmap\n"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/external-endpoint.domain", []byte("configmap.example.com"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/..data/should-do-that", []byte("ignored"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/.hidden", []byte("ignored"), 0644))
+
+	order := []string{}
+	cfg := &testConf{}
+
+	err := Run(App{
+		Config:     cfg,
+		ConfigPath: validConfigPath,
+		Fs:         fs,
+		Args:       []string{},
+		RootCommand: Command{
+			Name: "sources",
+		},
+		Sources: []Source{
+			FileSource(),
+			JSONFileSource{
+				Path: "/dump.json",
+			},
+			ConfigMapSource{
+				Dir: "/configmap",
+			},
+			JSONFileSource{
+				Path: "/missing.json",
+			},
+			funcSource{
+				name: "custom",
+				load: func(into interface{}) error {
+					order = append(order, into.(*testConf).ShouldEnableThis)
+					return nil
+				},
+			},
+		},
+	}, &DummyExecutor{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"from-configmap"}, order)
+	assert.Equal(t, &testConf{
+		ShouldEnableThis: "from-configmap",
+		ShouldDoThat:     "from-json",
+		ExternalEndpoint: testExtEndpoint{
+			// from the yaml file
+			Protocol: "https",
+			Domain:   "configmap.example.com",
+			Port:     9090,
+		},
+		ListOfThings: []string{"a", "b"},
+	}, cfg)
+}
+
+func TestRun_SourceErrors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/bad.json", []byte(`{"should-do-that": `), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/external-endpoint.port", []byte("not-a-port"), 0644))
+	customErr := errors.New("custom failed")
+
+	tests := []struct {
+		name         string
+		source       Source
+		expectedErr  error
+		expectedType error
+	}{
+		{
+			name: "invalid json",
+			source: JSONFileSource{
+				Path: "/bad.json",
+			},
+			expectedType: ErrLoadingSource{},
+		},
+		{
+			name: "json must exist",
+			source: JSONFileSource{
+				Path:      "/missing.json",
+				MustExist: true,
+			},
+			expectedType: ErrConfigFileNotFound{},
+		},
+		{
+			name: "configmap value of wrong type",
+			source: ConfigMapSource{
+				Dir: "/configmap",
+			},
+			expectedType: ErrLoadingSource{},
+		},
+		{
+			name: "configmap must exist",
+			source: ConfigMapSource{
+				Dir:       "/missing",
+				MustExist: true,
+			},
+			expectedType: ErrLoadingSource{},
+		},
+		{
+			name: "custom source",
+			source: funcSource{
+				name: "custom",
+				load: func(into interface{}) error {
+					return customErr
+				},
+			},
+			expectedErr: customErr,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			err := Run(App{
+				Config:  &testConf{},
+				Fs:      fs,
+				Args:    []string{},
+				Sources: []Source{test.source},
+				RootCommand: Command{
+					Name: "sourceerrors",
+				},
+			}, &DummyExecutor{})
+
+			if test.expectedErr != nil {
+				assert.Equal(tt, test.expectedErr, err)
+			} else {
+				assert.IsType(tt, test.expectedType, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Reload_RerunsSources(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/should-do-that", []byte("first"), 0644))
+
+	exec := &DummyExecutor{}
+	err := Run(App{
+		Config: &testConf{},
+		Fs:     fs,
+		Args:   []string{},
+		Sources: []Source{
+			ConfigMapSource{
+				Dir: "/configmap",
+			},
+		},
+		RootCommand: Command{
+			Name: "reloadsources",
+		},
+	}, exec)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "first", ConfigFromContext(exec.ctx).(*testConf).ShouldDoThat)
+
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/should-do-that", []byte("second"), 0644))
+	assert.Nil(t, ConfigManagerFromContext(exec.ctx).Reload())
+	assert.Equal(t, "second", ConfigFromContext(exec.ctx).(*testConf).ShouldDoThat)
+}
+
+func TestSetYAMLValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    [][]string
+		expected error
+	}{
+		{
+			name:  "nested keys",
+			paths: [][]string{{"a", "b"}, {"a", "c"}, {"d"}},
+		},
+		{
+			name:  "replacing a scalar",
+			paths: [][]string{{"a"}, {"a"}},
+		},
+		{
+			name:  "key below a scalar",
+			paths: [][]string{{"a"}, {"a", "b", "c"}},
+			expected: ErrConflictingConfigKey{
+				Key:      "a.b.c",
+				Conflict: "a",
+			},
+		},
+		{
+			name:  "scalar replacing a mapping",
+			paths: [][]string{{"a", "b"}, {"a"}},
+			expected: ErrConflictingConfigKey{
+				Key:      "a",
+				Conflict: "a",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			root := &yaml.Node{
+				Kind: yaml.MappingNode,
+			}
+
+			var err error
+			for _, p := range test.paths {
+				if err = setYAMLValue(root, p, "v"); err != nil {
+					break
+				}
+			}
+
+			assert.Equal(tt, test.expected, err)
+		})
+	}
+}
+
+func TestConfigMapSource_ConflictingKeys(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/external-endpoint", []byte("scalar"), 0644))
+	assert.Nil(t, afero.WriteFile(fs, "/configmap/external-endpoint.port", []byte("8080"), 0644))
+
+	err := Run(App{
+		Config: &testConf{},
+		Fs:     fs,
+		Args:   []string{},
+		Sources: []Source{
+			ConfigMapSource{
+				Dir: "/configmap",
+			},
+		},
+		RootCommand: Command{
+			Name: "conflicts",
+		},
+	}, &DummyExecutor{})
+
+	assert.Equal(t, ErrLoadingSource{
+		Source: "configmap:/configmap",
+		wrapped: ErrConflictingConfigKey{
+			Key:      "external-endpoint.port",
+			Conflict: "external-endpoint",
+		},
+	}, err)
+}
@@ -0,0 +1,545 @@
+// Package stdflag provides a clapp.Executor built on the standard library's
+// flag package, for small binaries where the size of cobra matters.
+//
+//	err := clapp.Run(app, stdflag.NewExecutor())
+package stdflag
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/svartlfheim/clapp"
+)
+
+// Executor runs commands using the flag package. Flags use the flag package's
+// syntax, so they must come before positional args, a single dash is the same
+// as two e.g. -config, and short bool flags cannot be combined e.g. -ab.
+// Persistent flags can be given before or after the name of a child command.
+// CustomConfiguration is applied to the cobra command the handler is given,
+// so its pre run hooks run, but it can't change how flags are parsed or how
+// help is shown.
+type Executor struct{}
+
+func NewExecutor() *Executor {
+	return &Executor{}
+}
+
+// stdFlag is a flag along with the storage it is parsed into.
+type stdFlag struct {
+	clapp.Flag
+	parsed interface{}
+	value  flag.Value
+}
+
+// command is a built command.
+type command struct {
+	cmd        clapp.Command
+	parent     *command
+	children   []*command
+	persistent []*stdFlag
+	local      []*stdFlag
+}
+
+type builder struct {
+	_cmd *command
+}
+
+func newBuilder() *builder {
+	return &builder{
+		_cmd: &command{},
+	}
+}
+
+func (e Executor) Run(c clapp.Command, ctx context.Context, cfg interface{}) error {
+	// the tree is built for each run, as flags record whether they were given
+	built, err := newBuilder().Build(c)
+
+	if err != nil {
+		return err
+	}
+
+	args := clapp.ArgsFromContext(ctx)
+
+	if args == nil {
+		args = os.Args[1:]
+	}
+
+	return built.execute(ctx, args)
+}
+
+// PreParseFlag reads f from args as the flag package does, so one dash is
+// the same as two and values are only attached with =.
+func (e Executor) PreParseFlag(args []string, f clapp.Flag) []string {
+	values := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		// Everything after a bare -- is positional
+		if arg == "--" {
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+
+		name := strings.TrimPrefix(arg[1:], "-")
+		value, attached := "", false
+
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value, attached = name[:eq], name[eq+1:], true
+		}
+
+		if name == "" || (name != f.Name && name != f.Short) {
+			continue
+		}
+
+		switch {
+		case attached:
+			values = append(values, value)
+		case f.Type == clapp.BoolFlag:
+			values = append(values, "true")
+		case i+1 < len(args):
+			values = append(values, args[i+1])
+			i++
+		}
+	}
+
+	return values
+}
+
+func (b *builder) Build(cmd clapp.Command) (*command, error) {
+	b._cmd.cmd = cmd
+
+	for _, f := range cmd.PersistentFlags {
+		sf, err := newFlag(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b._cmd.persistent = append(b._cmd.persistent, sf)
+	}
+
+	for _, f := range cmd.LocalFlags {
+		sf, err := newFlag(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b._cmd.local = append(b._cmd.local, sf)
+	}
+
+	for _, c := range cmd.Children {
+		child, err := newBuilder().Build(c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		child.parent = b._cmd
+		b._cmd.children = append(b._cmd.children, child)
+	}
+
+	return b._cmd, nil
+}
+
+// newFlag creates the storage for a flag, starting with the current value of
+// its ValueRef. The ValueRef is only updated when the flag is given.
+func newFlag(f clapp.Flag) (*stdFlag, error) {
+	if err := f.CheckValueRef(); err != nil {
+		return nil, err
+	}
+
+	sf := &stdFlag{
+		Flag: f,
+	}
+
+	switch ref := f.ValueRef.(type) {
+	case *string:
+		v := *ref
+		sf.parsed = &v
+		sf.value = (*stringValue)(&v)
+	case *[]string:
+		v := append([]string{}, *ref...)
+		sf.parsed = &v
+		sf.value = &stringSliceValue{
+			value: &v,
+		}
+	case *int:
+		v := *ref
+		sf.parsed = &v
+		sf.value = (*intValue)(&v)
+	case *[]int:
+		v := append([]int{}, *ref...)
+		sf.parsed = &v
+		sf.value = &intSliceValue{
+			value: &v,
+		}
+	case *bool:
+		v := *ref
+		sf.parsed = &v
+		sf.value = (*boolValue)(&v)
+	}
+
+	return sf, nil
+}
+
+// flags returns every flag the command accepts, inherited persistent flags
+// first.
+func (c *command) flags() []*stdFlag {
+	flags := []*stdFlag{}
+
+	for p := c.parent; p != nil; p = p.parent {
+		flags = append(append([]*stdFlag{}, p.persistent...), flags...)
+	}
+
+	flags = append(flags, c.persistent...)
+
+	return append(flags, c.local...)
+}
+
+func (c *command) flagSet() (*flag.FlagSet, map[string]*stdFlag) {
+	fs := flag.NewFlagSet(c.commandPath(), flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	byName := map[string]*stdFlag{}
+
+	for _, f := range c.flags() {
+		fs.Var(f.value, f.Name, f.Description)
+		byName[f.Name] = f
+
+		if f.Short != "" {
+			fs.Var(f.value, f.Short, f.Description)
+			byName[f.Short] = f
+		}
+	}
+
+	return fs, byName
+}
+
+const unknownFlagPrefix string = "flag provided but not defined: -"
+
+// flagError turns the flag package's error for an unknown flag into an
+// ErrUnknownFlag.
+func (c *command) flagError(err error) error {
+	if !strings.HasPrefix(err.Error(), unknownFlagPrefix) {
+		return err
+	}
+
+	names := []string{}
+	for _, f := range c.flags() {
+		names = append(names, f.Name)
+	}
+
+	name := strings.TrimLeft(strings.TrimPrefix(err.Error(), unknownFlagPrefix), "-")
+
+	return clapp.ErrUnknownFlag{
+		Name:        name,
+		Command:     c.commandPath(),
+		Suggestions: clapp.Suggest(name, names),
+	}
+}
+
+// unknownCommand is the error for a child of c that doesn't exist, hidden and
+// deprecated commands aren't suggested as they aren't shown in help.
+func (c *command) unknownCommand(name string) error {
+	names := []string{}
+	for _, child := range c.cmd.Children {
+		if !child.Hidden && child.Deprecated == "" {
+			names = append(names, child.Name)
+		}
+	}
+
+	return clapp.ErrUnknownCommand{
+		Name:        name,
+		Parent:      c.commandPath(),
+		Suggestions: clapp.Suggest(name, names),
+	}
+}
+
+func (c *command) child(name string) *command {
+	for _, child := range c.children {
+		if child.cmd.Name == name {
+			return child
+		}
+
+		for _, alias := range child.cmd.Aliases {
+			if alias == name {
+				return child
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *command) execute(ctx context.Context, args []string) error {
+	given := []*stdFlag{}
+	seen := map[*stdFlag]bool{}
+
+	for {
+		fs, byName := c.flagSet()
+
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return c.root().help(ctx, c.path())
+			}
+
+			err = c.flagError(err)
+			printError(ctx, err, c.commandPath())
+
+			return err
+		}
+
+		fs.Visit(func(f *flag.Flag) {
+			if sf := byName[f.Name]; !seen[sf] {
+				seen[sf] = true
+				given = append(given, sf)
+			}
+		})
+
+		args = fs.Args()
+
+		if len(args) == 0 {
+			break
+		}
+
+		if child := c.child(args[0]); child != nil {
+			c = child
+			args = args[1:]
+			continue
+		}
+
+		if args[0] == "help" && c.parent == nil && len(c.children) > 0 {
+			return c.help(ctx, args[1:])
+		}
+
+		break
+	}
+
+	if c.parent == nil && len(c.children) > 0 && len(args) > 0 {
+		err := c.unknownCommand(args[0])
+		printError(ctx, err, c.commandPath())
+
+		return err
+	}
+
+	missing := []string{}
+	for _, f := range c.flags() {
+		if f.Required && !seen[f] {
+			missing = append(missing, f.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		err := clapp.ErrRequiredFlagsNotSet{
+			Names: missing,
+		}
+		printError(ctx, err, c.commandPath())
+
+		return err
+	}
+
+	for _, f := range given {
+		clapp.ApplyFlag(ctx, c.commandPath(), f.Flag, f.parsed)
+	}
+
+	if c.cmd.Handle == nil {
+		return c.root().help(ctx, c.path())
+	}
+
+	return clapp.CallHandler(ctx, c.root().cmd, c.path(), args)
+}
+
+// help handles the help command and flag, e.g. app help child grandchild.
+func (c *command) help(ctx context.Context, path []string) error {
+	err := clapp.WriteHelp(ctx, clapp.StdoutFromContext(ctx), c.cmd, path)
+
+	if unknown, ok := err.(clapp.ErrUnknownCommand); ok {
+		printError(ctx, unknown, unknown.Parent)
+	}
+
+	return err
+}
+
+// printError writes err as cobra would, with a pointer to the help of the
+// command at path.
+func printError(ctx context.Context, err error, path string) {
+	fmt.Fprintf(clapp.StderrFromContext(ctx), "Error: %s\nRun '%s --help' for usage.\n", err, path)
+}
+
+func (c *command) root() *command {
+	for c.parent != nil {
+		c = c.parent
+	}
+
+	return c
+}
+
+// path is the names of the commands from below the root to c.
+func (c *command) path() []string {
+	path := []string{}
+	for n := c; n.parent != nil; n = n.parent {
+		path = append([]string{n.cmd.Name}, path...)
+	}
+
+	return path
+}
+
+// commandPath is the names of the commands from the root to c, as cobra's
+// CommandPath.
+func (c *command) commandPath() string {
+	return strings.Join(append([]string{c.root().cmd.Name}, c.path()...), " ")
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.ParseInt(s, 0, strconv.IntSize)
+
+	if err != nil {
+		return err
+	}
+
+	*v = intValue(i)
+
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+
+	if err != nil {
+		return err
+	}
+
+	*v = boolValue(b)
+
+	return nil
+}
+
+func (v *boolValue) String() string {
+	return strconv.FormatBool(bool(*v))
+}
+
+func (v *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+// readCSV splits a slice flag's value as pflag does, so quoted values may
+// contain commas.
+func readCSV(s string) ([]string, error) {
+	if s == "" {
+		return []string{}, nil
+	}
+
+	return csv.NewReader(strings.NewReader(s)).Read()
+}
+
+// stringSliceValue replaces the default the first time it is set, later
+// values are appended so the flag can be repeated.
+type stringSliceValue struct {
+	value   *[]string
+	changed bool
+}
+
+func (v *stringSliceValue) Set(s string) error {
+	vals, err := readCSV(s)
+
+	if err != nil {
+		return err
+	}
+
+	if !v.changed {
+		*v.value = vals
+		v.changed = true
+
+		return nil
+	}
+
+	*v.value = append(*v.value, vals...)
+
+	return nil
+}
+
+func (v *stringSliceValue) String() string {
+	if v.value == nil {
+		return "[]"
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(*v.value, ","))
+}
+
+type intSliceValue struct {
+	value   *[]int
+	changed bool
+}
+
+func (v *intSliceValue) Set(s string) error {
+	vals, err := readCSV(s)
+
+	if err != nil {
+		return err
+	}
+
+	ints := make([]int, 0, len(vals))
+
+	for _, val := range vals {
+		i, err := strconv.Atoi(strings.TrimSpace(val))
+
+		if err != nil {
+			return err
+		}
+
+		ints = append(ints, i)
+	}
+
+	if !v.changed {
+		*v.value = ints
+		v.changed = true
+
+		return nil
+	}
+
+	*v.value = append(*v.value, ints...)
+
+	return nil
+}
+
+func (v *intSliceValue) String() string {
+	if v.value == nil {
+		return "[]"
+	}
+
+	parts := []string{}
+	for _, i := range *v.value {
+		parts = append(parts, strconv.Itoa(i))
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(parts, ","))
+}
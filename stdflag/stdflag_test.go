@@ -0,0 +1,188 @@
+package stdflag
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/svartlfheim/clapp"
+	"github.com/svartlfheim/clapp/executortest"
+)
+
+func TestExecutor(t *testing.T) {
+	executortest.Run(t, func() clapp.Executor {
+		return NewExecutor()
+	})
+}
+
+func TestExecutor_PreParseFlag(t *testing.T) {
+	config := clapp.Flag{
+		Name:  "config",
+		Short: "c",
+		Type:  clapp.StringSliceFlag,
+	}
+	version := clapp.Flag{
+		Name: "version",
+		Type: clapp.BoolFlag,
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		f        clapp.Flag
+		expected []string
+	}{
+		{
+			name:     "single dash",
+			args:     []string{"-config", "/a.yaml", "child"},
+			f:        config,
+			expected: []string{"/a.yaml"},
+		},
+		{
+			name:     "double dash and equals",
+			args:     []string{"--config=/a.yaml", "-config=/b.yaml"},
+			f:        config,
+			expected: []string{"/a.yaml", "/b.yaml"},
+		},
+		{
+			name:     "shorthand",
+			args:     []string{"-c", "/a.yaml", "--c=/b.yaml"},
+			f:        config,
+			expected: []string{"/a.yaml", "/b.yaml"},
+		},
+		{
+			name:     "values are not attached to shorthands",
+			args:     []string{"-cfoo.yaml", "-configs", "/a.yaml"},
+			f:        config,
+			expected: []string{},
+		},
+		{
+			name:     "values after -- are ignored",
+			args:     []string{"-c", "/a.yaml", "--", "-c", "/b.yaml"},
+			f:        config,
+			expected: []string{"/a.yaml"},
+		},
+		{
+			name:     "bool flags",
+			args:     []string{"-version", "child"},
+			f:        version,
+			expected: []string{"true"},
+		},
+		{
+			name:     "bool flags with a value",
+			args:     []string{"--version", "-version=false"},
+			f:        version,
+			expected: []string{"true", "false"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, NewExecutor().PreParseFlag(test.args, test.f))
+		})
+	}
+}
+
+type testConf struct {
+	Setting string `yaml:"setting"`
+}
+
+func TestRun_BuiltinFlagsUseFlagSyntax(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "config",
+			args:     []string{"-config", "/other.yaml"},
+			expected: "from-other\n",
+		},
+		{
+			name:     "profile",
+			args:     []string{"-profile", "dev"},
+			expected: "from-dev\n",
+		},
+		{
+			name:     "version",
+			args:     []string{"-version"},
+			expected: "app version 1.2.3\n",
+		},
+		{
+			name:     "help all",
+			args:     []string{"-help-all"},
+			expected: "Usage:\n  app [flags]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			fs := afero.NewMemMapFs()
+			assert.Nil(tt, afero.WriteFile(fs, "/app.yaml", []byte("setting: from-file\n"), 0644))
+			assert.Nil(tt, afero.WriteFile(fs, "/app.dev.yaml", []byte("setting: from-dev\n"), 0644))
+			assert.Nil(tt, afero.WriteFile(fs, "/other.yaml", []byte("setting: from-other\n"), 0644))
+
+			out := &bytes.Buffer{}
+			cfg := &testConf{}
+
+			err := clapp.Run(clapp.App{
+				Config:         cfg,
+				ConfigPath:     "/app.yaml",
+				Fs:             fs,
+				Args:           test.args,
+				Environ:        clapp.Environ{},
+				Stdout:         out,
+				Stderr:         out,
+				Version:        "1.2.3",
+				VersionCommand: true,
+				Help: &clapp.HelpOptions{
+					HelpAll: true,
+				},
+				RootCommand: clapp.Command{
+					Name: "app",
+					Handle: func(cmd *cobra.Command, args []string) error {
+						_, err := cmd.OutOrStdout().Write([]byte(cfg.Setting + "\n"))
+						return err
+					},
+				},
+			}, NewExecutor())
+
+			assert.Nil(tt, err)
+			assert.Contains(tt, out.String(), test.expected)
+		})
+	}
+}
+
+func TestRun_OutputFlagIgnoresLongerFlags(t *testing.T) {
+	out := &bytes.Buffer{}
+	only := ""
+
+	err := clapp.Run(clapp.App{
+		Config:     &testConf{},
+		Fs:         afero.NewMemMapFs(),
+		Args:       []string{"-only=x"},
+		Environ:    clapp.Environ{},
+		Stdout:     out,
+		Stderr:     out,
+		OutputFlag: true,
+		RootCommand: clapp.Command{
+			Name: "app",
+			LocalFlags: []clapp.Flag{
+				{
+					Name:     "only",
+					ValueRef: &only,
+					Type:     clapp.StringFlag,
+				},
+			},
+			Handle: func(cmd *cobra.Command, args []string) error {
+				_, err := cmd.OutOrStdout().Write([]byte(only + "\n"))
+				return err
+			},
+		},
+	}, NewExecutor())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "x\n", out.String())
+}
@@ -32,9 +32,14 @@ var aintValidYAML = `{CW £863
 		tabs everywhere!!!
 `
 
+var unknownKeyYAML string = `should-enable-this: "awesome-feature"
+should-do-this: "typo"
+`
+
 var configDir string = "/config-test/meh/"
 var validConfigPath string = fmt.Sprintf("%s/%s.yaml", configDir, "valid")
 var invalidConfigPath string = fmt.Sprintf("%s/%s.yaml", configDir, "invalid")
+var unknownKeyConfigPath string = fmt.Sprintf("%s/%s.yaml", configDir, "unknown-key")
 
 type contextStub struct {
 	DeadlineVal    time.Time
@@ -108,6 +113,10 @@ func buildMockFs() afero.Fs {
 		panic(err)
 	}
 
+	if err := afero.WriteFile(fs, unknownKeyConfigPath, []byte(unknownKeyYAML), 0644); err != nil {
+		panic(err)
+	}
+
 	return fs
 }
 
@@ -158,3 +167,11 @@ func (cb *cobraBuilderStub) Build(cmd Command, cfg interface{}) (i interface{},
 
 	return
 }
+
+type permissionDeniedFs struct {
+	afero.Fs
+}
+
+func (fs permissionDeniedFs) Stat(name string) (os.FileInfo, error) {
+	return nil, os.ErrPermission
+}
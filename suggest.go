@@ -0,0 +1,292 @@
+package clapp
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// suggestionDistance is the largest Levenshtein distance between a mistyped
+// name and a known one for the known one to be suggested, names that start
+// with what was typed are always suggested.
+const suggestionDistance int = 2
+
+// Suggest returns the candidates close to name, the closest first, for errors
+// about unknown names.
+func Suggest(name string, candidates []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+
+	matches := []match{}
+	seen := map[string]bool{}
+	lower := strings.ToLower(name)
+
+	for _, c := range candidates {
+		if seen[c] || c == name || name == "" {
+			continue
+		}
+
+		seen[c] = true
+		d := levenshtein(lower, strings.ToLower(c))
+
+		if d <= suggestionDistance || strings.HasPrefix(strings.ToLower(c), lower) {
+			matches = append(matches, match{
+				name:     c,
+				distance: d,
+			})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+
+		return matches[i].name < matches[j].name
+	})
+
+	suggestions := []string{}
+	for _, m := range matches {
+		suggestions = append(suggestions, m.name)
+	}
+
+	return suggestions
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// didYouMean formats suggestions for the end of an error message.
+func didYouMean(suggestions []string, format func(string) string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+
+	formatted := []string{}
+	for _, s := range suggestions {
+		formatted = append(formatted, format(s))
+	}
+
+	if len(formatted) == 1 {
+		return fmt.Sprintf(", did you mean %s?", formatted[0])
+	}
+
+	return fmt.Sprintf(", did you mean one of %s?", strings.Join(formatted, ", "))
+}
+
+func flagArg(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+
+	return "--" + name
+}
+
+// commandNames are the children of cmd that can be suggested, hidden and
+// deprecated commands are left out as they are in help.
+func commandNames(cmd Command) []string {
+	names := []string{}
+
+	for _, c := range cmd.Children {
+		if !c.Hidden && c.Deprecated == "" {
+			names = append(names, c.Name)
+		}
+	}
+
+	return names
+}
+
+func unknownCommand(cmd Command, path string, name string) ErrUnknownCommand {
+	return ErrUnknownCommand{
+		Name:        name,
+		Parent:      path,
+		Suggestions: Suggest(name, commandNames(cmd)),
+	}
+}
+
+// printCommandError writes err as cobra would, with a pointer to help when the
+// command wasn't found.
+func printCommandError(w io.Writer, err error) {
+	fmt.Fprintf(w, "Error: %s\n", err)
+
+	if unknown, ok := err.(ErrUnknownCommand); ok {
+		fmt.Fprintf(w, "Run '%s --help' for usage.\n", unknown.Parent)
+	}
+}
+
+var cobraUnknownCommandRegexp = regexp.MustCompile(`^unknown command "(.*)" for "(.*)"`)
+
+// cobraUnknownCommand turns cobra's error for an unknown command on the root
+// into an ErrUnknownCommand.
+func cobraUnknownCommand(root Command, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	m := cobraUnknownCommandRegexp.FindStringSubmatch(err.Error())
+
+	if m == nil {
+		return err
+	}
+
+	return unknownCommand(root, m[2], m[1])
+}
+
+var pflagUnknownRegexp = regexp.MustCompile(`^unknown (?:shorthand )?flag: (?:'(.)' in -\S+|--(\S+))$`)
+
+// cobraFlagError turns pflag's errors for unknown flags into ErrUnknownFlag.
+func cobraFlagError(c *cobra.Command, err error) error {
+	m := pflagUnknownRegexp.FindStringSubmatch(err.Error())
+
+	if m == nil {
+		return err
+	}
+
+	names := []string{}
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Hidden {
+			names = append(names, f.Name)
+		}
+	})
+
+	name := m[1] + m[2]
+
+	return ErrUnknownFlag{
+		Name:        name,
+		Command:     c.CommandPath(),
+		Suggestions: Suggest(name, names),
+	}
+}
+
+var yamlUnknownFieldRegexp = regexp.MustCompile(`^line (\d+): field (.+) not found in type \S+$`)
+
+// newErrUnknownConfigKeys turns the errors from strict decoding into an
+// ErrUnknownConfigKeys when every one of them is for an unknown key.
+func newErrUnknownConfigKeys(err error, doc *yaml.Node, cfg interface{}) (ErrUnknownConfigKeys, bool) {
+	typeErr, ok := err.(*yaml.TypeError)
+
+	if !ok {
+		return ErrUnknownConfigKeys{}, false
+	}
+
+	fields, fErr := collectConfigFields(cfg, "")
+
+	if fErr != nil {
+		return ErrUnknownConfigKeys{}, false
+	}
+
+	unknown := ErrUnknownConfigKeys{}
+
+	for _, msg := range typeErr.Errors {
+		m := yamlUnknownFieldRegexp.FindStringSubmatch(msg)
+
+		if m == nil {
+			return ErrUnknownConfigKeys{}, false
+		}
+
+		key := UnknownConfigKey{
+			Key:         m[2],
+			Suggestions: []string{},
+		}
+		key.Line, _ = strconv.Atoi(m[1])
+
+		if parent, found := yamlKeyParent(doc, key.Key, key.Line); found {
+			key.Path = strings.Join(append(parent, key.Key), ".")
+			key.Suggestions = Suggest(key.Key, childYAMLKeys(fields, parent))
+		}
+
+		unknown.Keys = append(unknown.Keys, key)
+	}
+
+	return unknown, len(unknown.Keys) > 0
+}
+
+// yamlKeyParent finds the path of the mapping holding key, preferring the one
+// on line as the document may have been rewritten since it was parsed.
+func yamlKeyParent(doc *yaml.Node, key string, line int) ([]string, bool) {
+	var found []string
+	var onLine bool
+
+	var visit func(n *yaml.Node, path []string)
+	visit = func(n *yaml.Node, path []string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				visit(c, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				k := n.Content[i]
+
+				if k.Value == key && !onLine && (found == nil || k.Line == line) {
+					found = append([]string{}, path...)
+					onLine = k.Line == line
+				}
+
+				visit(n.Content[i+1], append(append([]string{}, path...), k.Value))
+			}
+		}
+	}
+
+	visit(doc, []string{})
+
+	return found, found != nil
+}
+
+// childYAMLKeys lists the keys that can appear in the mapping at parent.
+func childYAMLKeys(fields []configField, parent []string) []string {
+	keys := []string{}
+
+	for _, f := range fields {
+		if len(f.YAMLPath) <= len(parent) {
+			continue
+		}
+
+		if strings.Join(f.YAMLPath[:len(parent)], ".") == strings.Join(parent, ".") {
+			keys = append(keys, f.YAMLPath[len(parent)])
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,172 @@
+package clapp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{a: "", b: "", expected: 0},
+		{a: "deploy", b: "deploy", expected: 0},
+		{a: "", b: "abc", expected: 3},
+		{a: "dpeloy", b: "deploy", expected: 2},
+		{a: "kitten", b: "sitting", expected: 3},
+		{a: "ünicode", b: "unicode", expected: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, levenshtein(test.a, test.b))
+			assert.Equal(tt, test.expected, levenshtein(test.b, test.a))
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"deploy", "delete", "describe", "status", "Retry"}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "close names",
+			input:    "dploy",
+			expected: []string{"deploy"},
+		},
+		{
+			name:     "closest first",
+			input:    "de",
+			expected: []string{"delete", "deploy", "describe"},
+		},
+		{
+			name:     "prefixes",
+			input:    "desc",
+			expected: []string{"describe"},
+		},
+		{
+			name:     "ignores case",
+			input:    "rtry",
+			expected: []string{"Retry"},
+		},
+		{
+			name:     "nothing close",
+			input:    "completely-different",
+			expected: []string{},
+		},
+		{
+			name:     "exact matches are not suggested",
+			input:    "status",
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, Suggest(test.input, candidates))
+		})
+	}
+}
+
+func TestSuggestionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name: "command",
+			err: ErrUnknownCommand{
+				Name:        "dploy",
+				Parent:      "app",
+				Suggestions: []string{"deploy"},
+			},
+			expected: `unknown command "dploy" for "app", did you mean "deploy"?`,
+		},
+		{
+			name: "command without suggestions",
+			err: ErrUnknownCommand{
+				Name:   "nope",
+				Parent: "app",
+			},
+			expected: `unknown command "nope" for "app"`,
+		},
+		{
+			name: "flags",
+			err: ErrUnknownFlag{
+				Name:        "nmae",
+				Command:     "app deploy",
+				Suggestions: []string{"name", "n"},
+			},
+			expected: `unknown flag --nmae for "app deploy", did you mean one of --name, -n?`,
+		},
+		{
+			name: "config keys",
+			err: ErrUnknownConfigKeys{
+				Keys: []UnknownConfigKey{
+					{Key: "prot", Line: 3, Suggestions: []string{"port"}},
+					{Key: "nope", Line: 4},
+				},
+			},
+			expected: `line 3: unknown config key "prot", did you mean "port"?; line 4: unknown config key "nope"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			assert.EqualError(tt, test.err, test.expected)
+		})
+	}
+}
+
+func TestRun_SuggestsConfigKeys(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	yaml := `should-do-that: yes
+external-endpoint:
+  protocl: https
+  domian: example.com
+`
+	assert.Nil(t, afero.WriteFile(fs, "/suggest.yaml", []byte(yaml), 0644))
+
+	err := Run(App{
+		Config:       &testConf{},
+		ConfigPath:   "/suggest.yaml",
+		Fs:           fs,
+		Args:         []string{},
+		Environ:      Environ{},
+		StrictConfig: true,
+		RootCommand: Command{
+			Name: "suggest",
+		},
+	}, NewCobraExecutor())
+
+	var unknown ErrUnknownConfigKeys
+	assert.True(t, errors.As(err, &unknown), "got %v", err)
+	assert.Equal(t, []UnknownConfigKey{
+		{
+			Key:         "protocl",
+			Path:        "external-endpoint.protocl",
+			Line:        3,
+			Suggestions: []string{"protocol"},
+		},
+		{
+			Key:         "domian",
+			Path:        "external-endpoint.domian",
+			Line:        4,
+			Suggestions: []string{"domain"},
+		},
+	}, unknown.Keys)
+
+	var unmarshalling ErrUnmarshallingYAML
+	assert.True(t, errors.As(err, &unmarshalling))
+	assert.Equal(t, 3, unmarshalling.Line)
+}
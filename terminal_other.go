@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package clapp
+
+import "io"
+
+// terminalWidth can't tell whether w is a terminal on this platform, so it is
+// never treated as one.
+func terminalWidth(w io.Writer) (int, bool) {
+	return 0, false
+}
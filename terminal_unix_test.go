@@ -0,0 +1,133 @@
+//go:build linux
+// +build linux
+
+package clapp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// openTerminal opens a pseudo terminal with the given number of columns, it
+// returns the end help is written to and the end it can be read from.
+func openTerminal(t *testing.T, cols uint16) (*os.File, *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+
+	if err != nil {
+		t.Skipf("no pseudo terminals: %s", err)
+	}
+
+	t.Cleanup(func() { master.Close() })
+
+	unlock := int32(0)
+	assert.Nil(t, ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)))
+
+	n := uint32(0)
+	assert.Nil(t, ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)))
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+
+	if err != nil {
+		t.Skipf("no pseudo terminals: %s", err)
+	}
+
+	t.Cleanup(func() { slave.Close() })
+
+	assert.Nil(t, ioctl(slave, syscall.TIOCSWINSZ, unsafe.Pointer(&winsize{Row: 24, Col: cols})))
+
+	return slave, master
+}
+
+func TestTerminalWidth(t *testing.T) {
+	term, _ := openTerminal(t, 60)
+
+	width, ok := terminalWidth(term)
+	assert.True(t, ok)
+	assert.Equal(t, 60, width)
+
+	_, ok = terminalWidth(&bytes.Buffer{})
+	assert.False(t, ok)
+
+	f, err := ioutil.TempFile("", "clapp-terminal")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, ok = terminalWidth(f)
+	assert.False(t, ok)
+}
+
+func TestNewHelpRenderer_Terminal(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       HelpOptions
+		environ       Environ
+		expectedWidth int
+		expectedColor bool
+	}{
+		{
+			name:          "terminal",
+			options:       HelpOptions{Color: true},
+			environ:       Environ{},
+			expectedWidth: 60,
+			expectedColor: true,
+		},
+		{
+			name:          "COLUMNS and NO_COLOR",
+			options:       HelpOptions{Color: true},
+			environ:       Environ{"COLUMNS": "50", "NO_COLOR": "1"},
+			expectedWidth: 50,
+			expectedColor: false,
+		},
+		{
+			name:          "options",
+			options:       HelpOptions{Width: 40},
+			environ:       Environ{"COLUMNS": "50"},
+			expectedWidth: 40,
+			expectedColor: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			term, _ := openTerminal(tt, 60)
+
+			h, err := newHelpRenderer(test.options, Command{Name: "app"}, nil, nil, lookupEnvFunc(test.environ), term)
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.expectedWidth, h.width)
+			assert.Equal(tt, test.expectedColor, h.color)
+		})
+	}
+}
+
+func TestRun_HelpColor(t *testing.T) {
+	term, read := openTerminal(t, 200)
+
+	a := helpApp(&testHelpConf{}, &HelpOptions{Color: true}, []string{"--help"}, &bytes.Buffer{})
+	a.Stdout = term
+	a.Environ = Environ{}
+
+	assert.Nil(t, Run(a, NewCobraExecutor()))
+
+	b := make([]byte, 64*1024)
+	n, err := read.Read(b)
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(b[:n]), "\x1b[1mUsage:\x1b[0m")
+}
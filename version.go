@@ -0,0 +1,173 @@
+package clapp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var ErrInvalidVersionFormat error = errors.New("version format must be one of: text, json")
+
+type VersionFormat string
+
+const TextVersion VersionFormat = "text"
+const JSONVersion VersionFormat = "json"
+
+const versionCommandName string = "version"
+
+// These can be set when building, they take precedence over the build info
+// embedded by the go tool e.g.
+//
+//	go build -ldflags "-X github.com/svartlfheim/clapp.buildVersion=1.2.3
+//	  -X github.com/svartlfheim/clapp.buildRevision=$(git rev-parse HEAD)
+//	  -X github.com/svartlfheim/clapp.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	buildVersion  string
+	buildRevision string
+	buildTime     string
+)
+
+// develVersion is the module version the go tool gives builds that are not
+// from a tagged module e.g. go build in the module's own directory.
+const develVersion string = "(devel)"
+
+type BuildInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Dirty     bool   `json:"dirty"`
+	Time      string `json:"time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// NewBuildInfo describes the running binary. version is used when it is not
+// empty, otherwise the version comes from ldflags or the main module.
+func NewBuildInfo(name string, version string) BuildInfo {
+	bi := BuildInfo{
+		Name:      name,
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+
+	info, ok := debug.ReadBuildInfo()
+
+	if ok {
+		bi.Revision, bi.Time, bi.Dirty = vcsSettings(info)
+	}
+
+	if bi.Version == "" {
+		bi.Version = buildVersion
+	}
+
+	if bi.Version == "" && ok && info.Main.Version != develVersion {
+		bi.Version = info.Main.Version
+	}
+
+	if buildRevision != "" {
+		bi.Revision = buildRevision
+	}
+
+	if buildTime != "" {
+		bi.Time = buildTime
+	}
+
+	if bi.Version == "" {
+		bi.Version = "dev"
+	}
+
+	return bi
+}
+
+func (bi BuildInfo) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s version %s\n", bi.Name, bi.Version)
+
+	if bi.Revision != "" {
+		rev := bi.Revision
+
+		if bi.Dirty {
+			rev += " (dirty)"
+		}
+
+		fmt.Fprintf(&b, "revision: %s\n", rev)
+	}
+
+	if bi.Time != "" {
+		fmt.Fprintf(&b, "built:    %s\n", bi.Time)
+	}
+
+	fmt.Fprintf(&b, "go:       %s\n", bi.GoVersion)
+
+	return b.String()
+}
+
+func (bi BuildInfo) Write(w io.Writer, f VersionFormat) error {
+	switch f {
+	case TextVersion:
+		_, err := io.WriteString(w, bi.String())
+
+		return err
+	case JSONVersion:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(bi)
+	}
+
+	return ErrInvalidVersionFormat
+}
+
+// builtinVersion adds the --version flag to the root command and reports
+// whether it was given.
+func builtinVersion(root *Command, args []string, pre FlagPreParser) bool {
+	var version bool
+
+	f, added := addBuiltinFlag(root, Flag{
+		Name:        "version",
+		Description: "Show the version and exit",
+		ValueRef:    &version,
+		Type:        BoolFlag,
+	})
+
+	return added && preParseBoolFlag(pre, args, f)
+}
+
+func versionCommand(bi BuildInfo) Command {
+	format := string(TextVersion)
+
+	return Command{
+		Name: versionCommandName,
+		Descriptions: Descriptions{
+			Short: "Show the version of this application",
+		},
+		LocalFlags: []Flag{
+			{
+				Name:        "format",
+				Short:       "f",
+				Description: "The format to show the version in (text, json)",
+				ValueRef:    &format,
+				Type:        StringFlag,
+			},
+		},
+		Handle: func(cmd *cobra.Command, args []string) error {
+			return bi.Write(StdoutFromContext(cmd.Context()), VersionFormat(format))
+		},
+	}
+}
+
+func hasChild(cmd Command, name string) bool {
+	for _, c := range cmd.Children {
+		if c.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
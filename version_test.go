@@ -0,0 +1,204 @@
+package clapp
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBuildInfo(t *testing.T) {
+	defer func(v, r, tm string) {
+		buildVersion, buildRevision, buildTime = v, r, tm
+	}(buildVersion, buildRevision, buildTime)
+
+	bi := NewBuildInfo("app", "1.2.3")
+	assert.Equal(t, "app", bi.Name)
+	assert.Equal(t, "1.2.3", bi.Version)
+	assert.Equal(t, runtime.Version(), bi.GoVersion)
+
+	assert.NotEmpty(t, NewBuildInfo("app", "").Version)
+
+	buildVersion = "2.0.0"
+	buildRevision = "abc123"
+	buildTime = "2021-01-02T03:04:05Z"
+
+	bi = NewBuildInfo("app", "")
+	assert.Equal(t, "2.0.0", bi.Version)
+	assert.Equal(t, "abc123", bi.Revision)
+	assert.Equal(t, "2021-01-02T03:04:05Z", bi.Time)
+
+	assert.Equal(t, "1.2.3", NewBuildInfo("app", "1.2.3").Version)
+}
+
+func TestBuildInfo_Write(t *testing.T) {
+	bi := BuildInfo{
+		Name:      "app",
+		Version:   "1.2.3",
+		Revision:  "abc123",
+		Dirty:     true,
+		Time:      "2021-01-02T03:04:05Z",
+		GoVersion: "go1.15",
+	}
+
+	tests := []struct {
+		name     string
+		info     BuildInfo
+		format   VersionFormat
+		expected string
+		err      error
+	}{
+		{
+			name:   "text",
+			info:   bi,
+			format: TextVersion,
+			expected: `app version 1.2.3
+revision: abc123 (dirty)
+built:    2021-01-02T03:04:05Z
+go:       go1.15
+`,
+		},
+		{
+			name: "text without vcs details",
+			info: BuildInfo{
+				Name:      "app",
+				Version:   "dev",
+				GoVersion: "go1.15",
+			},
+			format: TextVersion,
+			expected: `app version dev
+go:       go1.15
+`,
+		},
+		{
+			name:   "json",
+			info:   bi,
+			format: JSONVersion,
+			expected: `{
+  "name": "app",
+  "version": "1.2.3",
+  "revision": "abc123",
+  "dirty": true,
+  "time": "2021-01-02T03:04:05Z",
+  "go_version": "go1.15"
+}
+`,
+		},
+		{
+			name:   "invalid format",
+			info:   bi,
+			format: VersionFormat("xml"),
+			err:    ErrInvalidVersionFormat,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			b := &bytes.Buffer{}
+			err := test.info.Write(b, test.format)
+
+			assert.Equal(tt, test.err, err)
+			assert.Equal(tt, test.expected, b.String())
+		})
+	}
+}
+
+func TestRun_Version(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		versionCommand bool
+		brokenConfig   bool
+		expected       []string
+		handled        bool
+		anyErr         bool
+	}{
+		{
+			name:           "version command",
+			args:           []string{"version"},
+			versionCommand: true,
+			expected:       []string{"versioned version 1.2.3\n"},
+		},
+		{
+			name:           "version command as json",
+			args:           []string{"version", "-f", "json"},
+			versionCommand: true,
+			expected:       []string{`"version": "1.2.3"`},
+		},
+		{
+			name:           "version flag skips the command and config",
+			args:           []string{"child", "--version"},
+			versionCommand: true,
+			brokenConfig:   true,
+			expected:       []string{"versioned version 1.2.3\n"},
+		},
+		{
+			name:           "version flag is listed in help",
+			args:           []string{"--help"},
+			versionCommand: true,
+			expected:       []string{"--version", "version     Show the version of this application"},
+		},
+		{
+			name:    "commands run as usual",
+			args:    []string{"child"},
+			handled: true,
+		},
+		{
+			name:   "version flag is not added by default",
+			args:   []string{"--version"},
+			anyErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			out := &bytes.Buffer{}
+			fs := afero.NewMemMapFs()
+			handled := false
+
+			// the version flag must work even when the config is broken
+			if test.brokenConfig {
+				assert.Nil(tt, afero.WriteFile(fs, "/versioned.yaml", []byte(aintValidYAML), 0644))
+			}
+
+			err := Run(App{
+				Config:         &testConf{},
+				ConfigPath:     "/versioned.yaml",
+				Fs:             fs,
+				Args:           test.args,
+				Environ:        Environ{},
+				Stdout:         out,
+				Stderr:         &bytes.Buffer{},
+				Version:        "1.2.3",
+				VersionCommand: test.versionCommand,
+				RootCommand: Command{
+					Name: "versioned",
+					Children: []Command{
+						{
+							Name: "child",
+							Handle: func(cmd *cobra.Command, args []string) error {
+								handled = true
+								return nil
+							},
+						},
+					},
+				},
+			}, NewCobraExecutor())
+
+			if test.anyErr {
+				assert.Error(tt, err)
+				return
+			}
+
+			assert.Nil(tt, err)
+			assert.Equal(tt, test.handled, handled)
+
+			for _, s := range test.expected {
+				assert.Contains(tt, out.String(), s)
+			}
+		})
+	}
+}